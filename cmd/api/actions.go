@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/action"
+	"github.com/llumus/lulis/internal/cache"
+	"github.com/llumus/lulis/internal/language"
+	"github.com/llumus/lulis/internal/locale"
+	"github.com/llumus/lulis/internal/persona"
+	"github.com/llumus/lulis/internal/queue"
+	"github.com/llumus/lulis/internal/scene"
+	"github.com/llumus/lulis/internal/stream/layout"
+)
+
+// overlayDuration is a knob to control how long an image picked by a persona stays on the stream
+const overlayDuration = 30 * time.Second
+
+// pollDuration is a knob to control how long the chat can vote in a poll started by a persona
+const pollDuration = 2 * time.Minute
+
+// pollMaxOptions is a knob to control how many options a poll can have, voted with their number in the chat
+const pollMaxOptions = 4
+
+// schema of the arguments of an action, every property is required
+func schema(properties map[string]any) json.RawMessage {
+	required := make([]string, 0, len(properties))
+	for name := range properties {
+		required = append(required, name)
+	}
+	sort.Strings(required)
+
+	data, _ := json.Marshal(map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	})
+
+	return data
+}
+
+// sceneAction plays one of the scenes of the manifest until the next rotation
+func sceneAction(idle *idleLoop, manifest *scene.Manifest, dir string) action.Action {
+	files := make(map[string]string)
+	names := make([]string, 0, len(manifest.Scenes))
+	for _, s := range manifest.Scenes {
+		files[s.Name] = s.File
+		names = append(names, s.Name)
+	}
+
+	return action.Action{
+		Name:        "play_animation",
+		Description: "Play an animation on the stream while you answer, when it fits what you say.",
+		Parameters: schema(map[string]any{
+			"animation": map[string]any{"type": "string", "enum": names},
+		}),
+		Run: func(ctx context.Context, args json.RawMessage) error {
+			var a struct {
+				Animation string `json:"animation"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil {
+				return err
+			}
+
+			file, ok := files[a.Animation]
+			if !ok {
+				return fmt.Errorf("unknown animation %q", a.Animation)
+			}
+
+			return idle.setScene(filepath.Join(dir, file))
+		},
+	}
+}
+
+// overlay shows the images picked by the personas in the overlay layers of the layout, the layers are cleared
+// with a transparent image once the overlay duration is over
+type overlay struct {
+	mu     sync.Mutex
+	layers []layout.Layer
+	images map[string]string
+	timer  *time.Timer
+}
+
+// newOverlay with the png images of dir, nil when the layout has no overlay layer or there are no images
+func newOverlay(l *layout.Layout, dir string) *overlay {
+	if l == nil {
+		return nil
+	}
+
+	layers := l.Sources(layout.SourceOverlay)
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.png"))
+	if len(layers) == 0 || len(paths) == 0 {
+		return nil
+	}
+
+	o := &overlay{layers: layers, images: make(map[string]string)}
+	for _, path := range paths {
+		o.images[strings.TrimSuffix(filepath.Base(path), ".png")] = path
+	}
+
+	o.clear()
+	return o
+}
+
+func (o *overlay) action() action.Action {
+	names := make([]string, 0, len(o.images))
+	for name := range o.images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return action.Action{
+		Name:        "show_image",
+		Description: "Show an image on the stream for a few seconds, when it illustrates what you say.",
+		Parameters: schema(map[string]any{
+			"image": map[string]any{"type": "string", "enum": names},
+		}),
+		Run: func(ctx context.Context, args json.RawMessage) error {
+			var a struct {
+				Image string `json:"image"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil {
+				return err
+			}
+
+			path, ok := o.images[a.Image]
+			if !ok {
+				return fmt.Errorf("unknown image %q", a.Image)
+			}
+
+			return o.show(path)
+		},
+	}
+}
+
+// show the image until the overlay duration is over, a new image replaces the one showing
+func (o *overlay) show(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, layer := range o.layers {
+		if err := replaceFile(layer.Path, data); err != nil {
+			return fmt.Errorf("error showing the image in layer %s: %w", layer.Name, err)
+		}
+	}
+
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	o.timer = time.AfterFunc(overlayDuration, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+
+		o.clear()
+	})
+
+	return nil
+}
+
+// clear the overlay layers with a transparent image, must be called with the lock held once the overlay is shared
+func (o *overlay) clear() {
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewNRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		log.Errorf("Error encoding the transparent overlay: %v", err)
+		return
+	}
+
+	for _, layer := range o.layers {
+		if err := replaceFile(layer.Path, b.Bytes()); err != nil {
+			log.Errorf("Error clearing the overlay layer %s: %v", layer.Name, err)
+		}
+	}
+}
+
+// replaceFile atomically so ffmpeg never reloads a half written image
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// chatPoll is a poll started by a persona, the viewers vote with the number of an option in the chat
+type chatPoll struct {
+	mu    sync.Mutex
+	rules *chatModeration
+	// moderate the poll like the answers before it goes to the chat
+	moderate func(ctx context.Context, kind string, text string) error
+	texts    *locale.Catalog
+	say      func(message string)
+	// lang of the answer that started the poll
+	lang     string
+	question string
+	options  []string
+	// votes of each viewer, the latest one counts
+	votes map[string]int
+	open  bool
+}
+
+func (c *chatPoll) action() action.Action {
+	return action.Action{
+		Name:        "start_poll",
+		Description: fmt.Sprintf("Start a poll in the chat, with 2 to %d short options, when you want the opinion of the viewers.", pollMaxOptions),
+		Parameters: schema(map[string]any{
+			"question": map[string]any{"type": "string"},
+			"options": map[string]any{
+				"type":     "array",
+				"items":    map[string]any{"type": "string"},
+				"minItems": 2,
+				"maxItems": pollMaxOptions,
+			},
+		}),
+		Run: func(ctx context.Context, args json.RawMessage) error {
+			var a struct {
+				Question string   `json:"question"`
+				Options  []string `json:"options"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil {
+				return err
+			}
+
+			lang, _ := language.FromContext(ctx)
+			return c.start(ctx, lang, a.Question, a.Options)
+		},
+	}
+}
+
+// start the poll, only one poll runs at a time. The question and the options are written by the model, they go
+// through the moderation rules and the moderation of the answers before the chat
+func (c *chatPoll) start(ctx context.Context, lang string, question string, options []string) error {
+	if strings.TrimSpace(question) == "" || len(options) < 2 || len(options) > pollMaxOptions {
+		return fmt.Errorf("a poll needs a question and 2 to %d options", pollMaxOptions)
+	}
+
+	question, err := c.rules.check("poll question", question, lang, lang)
+	if err != nil {
+		return err
+	}
+
+	checked := make([]string, 0, len(options))
+	for _, option := range options {
+		option, err := c.rules.check("poll option", option, lang, lang)
+		if err != nil {
+			return err
+		}
+		checked = append(checked, option)
+	}
+	options = checked
+
+	if err := c.moderate(ctx, "poll", question+"\n"+strings.Join(options, "\n")); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.open {
+		return fmt.Errorf("a poll is already running")
+	}
+
+	c.lang, c.question, c.options, c.votes, c.open = lang, question, options, make(map[string]int), true
+
+	choices := make([]string, 0, len(options))
+	for i, option := range options {
+		choices = append(choices, strconv.Itoa(i+1)+") "+option)
+	}
+	c.say(c.texts.Text(lang, "poll_started", "question", question, "options", strings.Join(choices, " ")))
+
+	time.AfterFunc(pollDuration, c.close)
+	return nil
+}
+
+// vote of a chat message, false when the message is not a vote of a running poll
+func (c *chatPoll) vote(user string, message string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.open {
+		return false
+	}
+
+	option, err := strconv.Atoi(strings.TrimSpace(message))
+	if err != nil || option < 1 || option > len(c.options) {
+		return false
+	}
+
+	c.votes[user] = option - 1
+	return true
+}
+
+// close the poll and announce its results
+func (c *chatPoll) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make([]int, len(c.options))
+	for _, option := range c.votes {
+		counts[option]++
+	}
+
+	results := make([]string, 0, len(c.options))
+	for i, option := range c.options {
+		results = append(results, fmt.Sprintf("%s: %d", option, counts[i]))
+	}
+
+	c.open = false
+	c.say(c.texts.Text(c.lang, "poll_closed", "question", c.question, "results", strings.Join(results, ", ")))
+}
+
+// replayAction plays again the cached clip of the persona answering a question close to the one of the model,
+// after the current answer
+func replayAction(answers cache.Cache, threshold float64, videoQueue queue.Queue) action.Action {
+	return action.Action{
+		Name:        "replay_clip",
+		Description: "Replay one of your previous answers after this one, when a viewer asks about something you already explained.",
+		Parameters: schema(map[string]any{
+			"question": map[string]any{"type": "string", "description": "The question of the previous answer"},
+		}),
+		Run: func(ctx context.Context, args json.RawMessage) error {
+			var a struct {
+				Question string `json:"question"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil {
+				return err
+			}
+
+			p, ok := persona.FromContext(ctx)
+			if !ok {
+				return fmt.Errorf("no persona to replay a clip of")
+			}
+
+			lang, _ := language.FromContext(ctx)
+			match, ok, err := answers.Lookup(ctx, cacheScope(p, lang), a.Question, threshold)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("no clip of %s answering %q", p.Name, a.Question)
+			}
+
+			log.Infof("Replaying the clip of %q for the action of %s", match.Question, p.Name)
+			videoQueue.Enqueue(match.Video)
+			return nil
+		},
+	}
+}
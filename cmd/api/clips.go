@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// clipFiles gives the clips of the jobs unique paths, the mixers and the stitcher rotate their outputs over slots
+// and the next job would overwrite a clip still queued, stitched or cached. Only the latest slots clips are kept
+type clipFiles struct {
+	mu    sync.Mutex
+	slots int
+	count int
+	paths []string
+	// jobs of the clips by path
+	jobs map[string]string
+}
+
+func newClipFiles(slots int) *clipFiles {
+	return &clipFiles{slots: slots, paths: make([]string, 0, slots), jobs: make(map[string]string, slots)}
+}
+
+// claim the clip of the job, moved next to it with a path of its own, and remove the oldest clip once over the slots
+func (c *clipFiles) claim(jobID string, path string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.count++
+	claimed := filepath.Join(filepath.Dir(path), fmt.Sprintf("%s-%d%s", jobID, c.count, filepath.Ext(path)))
+	if err := os.Rename(path, claimed); err != nil {
+		return "", fmt.Errorf("error claiming clip %s: %w", path, err)
+	}
+
+	if len(c.paths) >= c.slots {
+		if err := os.Remove(c.paths[0]); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Error removing clip %s: %v", c.paths[0], err)
+		}
+		delete(c.jobs, c.paths[0])
+		c.paths = c.paths[1:]
+	}
+
+	c.paths = append(c.paths, claimed)
+	c.jobs[claimed] = jobID
+	return claimed, nil
+}
+
+// job of a clip, false when the path is not a clip of a job, e.g. a replay from the cache
+func (c *clipFiles) job(path string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jobID, ok := c.jobs[path]
+	return jobID, ok
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/llumus/lulis/internal/cost"
+	"github.com/llumus/lulis/internal/locale"
+)
+
+// loadLedger to account the provider calls in tmp, with the prices of the file on top of the default ones
+func loadLedger(path string, pricesPath string) *cost.Ledger {
+	prices := cost.DefaultPrices
+	if pricesPath != "" {
+		var err error
+		prices, err = cost.LoadPrices(pricesPath)
+		if err != nil {
+			log.Fatalf("Error loading prices: %v", err)
+		}
+	}
+
+	ledger, err := cost.NewLedger(path, prices)
+	if err != nil {
+		log.Fatalf("Error loading cost ledger: %v", err)
+	}
+
+	return ledger
+}
+
+// loadGuard to follow the spending against the budget, nil without limits. The chat is told when the questions are
+// made cheaper and when they stop until the budget resets
+func loadGuard(ledger *cost.Ledger, limits cost.Limits, texts *locale.Catalog, say func(message string)) *cost.Guard {
+	if limits.Soft <= 0 && limits.Hard <= 0 {
+		return nil
+	}
+
+	var guard *cost.Guard
+	guard = cost.NewGuard(ledger, limits, func(from, to cost.Level) {
+		switch {
+		case to == cost.LevelHard:
+			say(texts.Text("", "budget_hard", "time", guard.NextReset().Format("15:04")))
+		case to == cost.LevelSoft && from == cost.LevelNormal:
+			say(texts.Text("", "budget_soft"))
+		case from == cost.LevelHard:
+			say(texts.Text("", "budget_open"))
+		}
+	})
+
+	return guard
+}
+
+// budgetSpent when the hard limit of the budget is reached, no new questions are taken until it resets
+func budgetSpent(guard *cost.Guard) bool {
+	return guard != nil && guard.Level() == cost.LevelHard
+}
+
+// costsHandler writes the spending of a day per provider, viewer and job, today or the day=2006-01-02 parameter
+func costsHandler(ledger *cost.Ledger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		day := time.Now()
+		if param := r.URL.Query().Get("day"); param != "" {
+			var err error
+			day, err = time.ParseInLocation("2006-01-02", param, time.Local)
+			if err != nil {
+				http.Error(w, "day must be formatted as 2006-01-02", http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ledger.Day(day))
+	}
+}
+
+// metricsHandler writes the usage and cost counters in the Prometheus text format, with the budget level when
+// there is a budget
+func metricsHandler(ledger *cost.Ledger, guard *cost.Guard) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		totals := ledger.Totals()
+
+		var b strings.Builder
+		b.WriteString("# HELP lulis_provider_usage_total Usage of the paid providers, in the unit of the label.\n")
+		b.WriteString("# TYPE lulis_provider_usage_total counter\n")
+		for _, t := range totals {
+			_, _ = fmt.Fprintf(&b, "lulis_provider_usage_total{%s} %g\n", labels(t), t.Quantity)
+		}
+
+		b.WriteString("# HELP lulis_provider_cost_dollars_total Estimated cost of the paid providers.\n")
+		b.WriteString("# TYPE lulis_provider_cost_dollars_total counter\n")
+		for _, t := range totals {
+			_, _ = fmt.Fprintf(&b, "lulis_provider_cost_dollars_total{%s} %g\n", labels(t), t.Cost)
+		}
+
+		b.WriteString("# HELP lulis_cost_today_dollars Estimated cost of the day so far.\n")
+		b.WriteString("# TYPE lulis_cost_today_dollars gauge\n")
+		year, month, day := time.Now().Date()
+		_, _ = fmt.Fprintf(&b, "lulis_cost_today_dollars %g\n", ledger.SpentSince(time.Date(year, month, day, 0, 0, 0, 0, time.Local)))
+
+		if guard != nil {
+			b.WriteString("# HELP lulis_budget_level Spending against the budget, 0 normal, 1 over the soft limit, 2 over the hard limit.\n")
+			b.WriteString("# TYPE lulis_budget_level gauge\n")
+			_, _ = fmt.Fprintf(&b, "lulis_budget_level %d\n", guard.Level())
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(b.String()))
+	}
+}
+
+func labels(t cost.Totals) string {
+	return fmt.Sprintf("provider=%q,model=%q,unit=%q", t.Provider, t.Model, t.Unit)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/interstitial"
+	"github.com/llumus/lulis/internal/job"
+	"github.com/llumus/lulis/internal/queue"
+	"github.com/llumus/lulis/internal/scene"
+	"github.com/llumus/lulis/internal/stream"
+)
+
+// interstitialTimeout is a knob to control how long rendering an interstitial card can take
+const interstitialTimeout = 30 * time.Second
+
+// idleLoop shares the stream idle loop between the scene rotation and the "coming up next" interstitials,
+// while an interstitial is showing the scene changes are only recorded and applied once it is cleared
+type idleLoop struct {
+	mu           sync.Mutex
+	streamer     stream.Stream
+	dir          string
+	scene        string
+	interstitial string
+}
+
+func newIdleLoop(streamer stream.Stream, dir string) *idleLoop {
+	return &idleLoop{
+		streamer: streamer,
+		dir:      dir,
+		scene:    filepath.Join(dir, "loop.mp4"),
+	}
+}
+
+func (l *idleLoop) setScene(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.scene = path
+	if l.interstitial != "" {
+		return nil
+	}
+
+	return l.streamer.SetIdleLoop(path)
+}
+
+func (l *idleLoop) setInterstitial(path string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.interstitial = path
+	return l.streamer.SetIdleLoop(path)
+}
+
+func (l *idleLoop) clearInterstitial() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.interstitial == "" {
+		return nil
+	}
+
+	l.interstitial = ""
+	return l.streamer.SetIdleLoop(l.scene)
+}
+
+// rotateScenes to switch the idle loop of the stream according to the scene manifest
+func (l *idleLoop) rotateScenes(scheduler *scene.Scheduler, interval time.Duration, queues ...queue.Queue) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var queueLength int
+		for _, q := range queues {
+			queueLength += q.Len()
+		}
+
+		next := scheduler.Next(time.Now(), queueLength)
+		if err := l.setScene(filepath.Join(l.dir, next.File)); err != nil {
+			log.Errorf("Error switching to scene %s: %v", next.Name, err)
+		}
+
+		<-ticker.C
+	}
+}
+
+// showInterstitials to render a "coming up next" card for the oldest pending job every time a job changes status,
+// the scene loop comes back once there are no pending jobs
+func (l *idleLoop) showInterstitials(renderer interstitial.Renderer, tracker *job.Tracker) {
+	events := tracker.Subscribe()
+	for event := range events {
+		// only the latest state matters, skip the events that piled up while rendering
+		for len(events) > 0 {
+			event = <-events
+		}
+
+		log.Debugf("Job %s is %s", event.Job.ID, event.Job.Status)
+
+		pending := tracker.Pending()
+		if len(pending) == 0 {
+			if err := l.clearInterstitial(); err != nil {
+				log.Errorf("Error clearing interstitial: %v", err)
+			}
+			continue
+		}
+
+		next := pending[0]
+		ctx, cancel := context.WithTimeout(context.Background(), interstitialTimeout)
+		path, err := renderer.Render(ctx, interstitial.Card{
+			Question: next.Question,
+			User:     next.User,
+			Status:   next.Status,
+			Pending:  len(pending),
+		})
+		cancel()
+
+		if err != nil {
+			log.Errorf("Error rendering interstitial for job %s: %v", next.ID, err)
+			continue
+		}
+
+		if err := l.setInterstitial(path); err != nil {
+			log.Errorf("Error showing interstitial: %v", err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/llumus/lulis/internal/job"
+	"github.com/llumus/lulis/internal/stream/layout"
+)
+
+// layoutFeeds writes the chat messages and the pending questions to the text layers of the stream layout
+type layoutFeeds struct {
+	chat      []*layout.TextFile
+	questions []*layout.TextFile
+}
+
+func newLayoutFeeds(l *layout.Layout) *layoutFeeds {
+	feeds := &layoutFeeds{}
+	if l == nil {
+		return feeds
+	}
+
+	for _, layer := range l.Sources(layout.SourceChat) {
+		feeds.chat = append(feeds.chat, layout.NewTextFile(layer))
+	}
+
+	for _, layer := range l.Sources(layout.SourceQuestions) {
+		feeds.questions = append(feeds.questions, layout.NewTextFile(layer))
+	}
+
+	return feeds
+}
+
+// addChatMessage to show a chat message in the chat layers
+func (f *layoutFeeds) addChatMessage(user, message string) {
+	for _, file := range f.chat {
+		if err := file.Append(user + ": " + message); err != nil {
+			log.Errorf("Error writing chat layer: %v", err)
+		}
+	}
+}
+
+// followQuestions to keep the questions layers with the pending questions
+func (f *layoutFeeds) followQuestions(tracker *job.Tracker) {
+	if len(f.questions) == 0 {
+		return
+	}
+
+	for range tracker.Subscribe() {
+		var lines []string
+		for _, j := range tracker.Pending() {
+			if j.User != "" {
+				lines = append(lines, j.User+": "+j.Question)
+			} else {
+				lines = append(lines, j.Question)
+			}
+		}
+
+		for _, file := range f.questions {
+			if err := file.Set(lines); err != nil {
+				log.Errorf("Error writing questions layer: %v", err)
+			}
+		}
+	}
+}
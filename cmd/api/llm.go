@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/llumus/lulis/internal/gpt"
+	"github.com/llumus/lulis/internal/gpt/chatcompletions"
+	"github.com/llumus/lulis/internal/gpt/fallback"
+)
+
+// defaultOpenAIModel is the model of the openai provider when none is set
+const defaultOpenAIModel = "gpt-4"
+
+// llmConfig is a LLM provider, from the LLM_* environment or an entry of the LLM_PROVIDERS_PATH file, empty
+// values use the defaults of the provider
+type llmConfig struct {
+	Name        string  `json:"name"`
+	Provider    string  `json:"provider"`
+	BaseURL     string  `json:"base_url"`
+	APIKey      string  `json:"api_key"`
+	Model       string  `json:"model"`
+	BudgetModel string  `json:"budget_model"`
+	Temperature float64 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens"`
+	Timeout     string  `json:"timeout"`
+}
+
+// loadLLM to chain the providers of the file in order, or the single provider of the environment, with
+// retries and a circuit breaker per provider. The providers of the file share nothing with the environment one
+func loadLLM(path string, env func() llmConfig, openAiKey string) *fallback.Fallback {
+	var configs []llmConfig
+
+	if path == "" {
+		configs = append(configs, env())
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error loading LLM providers: %v", err)
+		}
+
+		if err := json.Unmarshal(data, &configs); err != nil {
+			log.Fatalf("Error parsing LLM providers %s: %v", path, err)
+		}
+
+		if len(configs) == 0 {
+			log.Fatalf("No LLM providers in %s", path)
+		}
+	}
+
+	providers := make([]fallback.Provider, 0, len(configs))
+	for i, config := range configs {
+		name := config.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", config.provider(), i+1)
+		}
+
+		providers = append(providers, fallback.Provider{Name: name, Completer: newCompleter(config, openAiKey)})
+	}
+
+	return fallback.NewFallback(fallback.DefaultPolicy, providers...)
+}
+
+func (c llmConfig) provider() string {
+	if c.Provider == "" {
+		return "openai"
+	}
+
+	return c.Provider
+}
+
+// newCompleter the chat completion backend of the provider, openai by default, compatible for any OpenAI
+// compatible endpoint (the OpenAI api itself when there is no base url), ollama and llamacpp for the local servers
+func newCompleter(config llmConfig, openAiKey string) gpt.Completer {
+	c := chatcompletions.Config{
+		BaseURL:     config.BaseURL,
+		APIKey:      config.APIKey,
+		Model:       config.Model,
+		BudgetModel: config.BudgetModel,
+		Temperature: config.Temperature,
+		MaxTokens:   config.MaxTokens,
+	}
+
+	switch config.provider() {
+	case "openai":
+		if c.BaseURL == "" {
+			c.BaseURL = chatcompletions.OpenAIBaseURL
+		}
+		if c.APIKey == "" {
+			c.APIKey = openAiKey
+		}
+		if c.Model == "" {
+			c.Model = defaultOpenAIModel
+		}
+	case "ollama":
+		if c.BaseURL == "" {
+			c.BaseURL = chatcompletions.OllamaBaseURL
+		}
+	case "llamacpp":
+		if c.BaseURL == "" {
+			c.BaseURL = chatcompletions.LlamaCppBaseURL
+		}
+	case "compatible":
+		if c.BaseURL == "" {
+			c.BaseURL = chatcompletions.OpenAIBaseURL
+		}
+		if c.APIKey == "" {
+			c.APIKey = openAiKey
+		}
+	default:
+		log.Fatalf("Unknown LLM provider %s", config.Provider)
+	}
+
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			log.Fatalf("Invalid LLM timeout %s: %v", config.Timeout, err)
+		}
+		c.Timeout = timeout
+	}
+
+	if c.Model == "" {
+		log.Fatalf("A model is required for the %s provider", config.provider())
+	}
+
+	log.Infof("Using LLM provider %s at %s with %s", config.provider(), c.BaseURL, c.Model)
+	if c.BudgetModel != "" {
+		log.Infof("Using %s with the %s provider over the soft budget", c.BudgetModel, config.provider())
+	}
+	return chatcompletions.NewChatCompletions(c)
+}
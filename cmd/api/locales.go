@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/llumus/lulis/internal/language"
+)
+
+// chatTexts are the chat messages of the bot in English, the other languages are in the files of LOCALES_PATH
+var chatTexts = map[string]string{
+	"processing":        "We are processing your request {user}, please wait a minute or two.",
+	"debate_preparing":  "Preparing the debate {user}, please wait a few minutes.",
+	"debate_needs_two":  "A debate needs at least two personas, sorry {user}",
+	"no_more_questions": "Sorry {user}, no more questions today, we are back at {time}!",
+	"no_more_debates":   "Sorry {user}, no more debates today, we are back at {time}!",
+	"not_for_me":        "To talk to us, a message have to start with {triggers}",
+	"refused":           "Sorry, I can't say that.",
+	"replaying_answer":  "{user}, {persona} already answered a question like yours, here it is again!",
+	"almost_ready":      "Almost ready...",
+	"anytime_now":       "Anytime now...",
+	"playing_previous":  "Playing a previous question...",
+	"restarting":        "Back in some seconds!",
+	"budget_hard":       "That's all the questions for today, we are back at {time}!",
+	"budget_soft":       "Saving energy for the rest of the day, the answers will be shorter for a while.",
+	"budget_open":       "Questions are open again, ask away!",
+	"poll_started":      "Poll: {question} {options}. Vote with the number in the chat!",
+	"poll_closed":       "Poll closed! {question} {results}",
+}
+
+// viewerLanguages remembers the language of each viewer, for their messages too short to detect it
+type viewerLanguages struct {
+	mu        sync.Mutex
+	languages map[string]string
+}
+
+func newViewerLanguages() *viewerLanguages {
+	return &viewerLanguages{languages: make(map[string]string)}
+}
+
+// detect the language of the message of the viewer, the latest one detected for the viewer when it is unknown
+func (v *viewerLanguages) detect(user string, message string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if lang := language.Detect(message); lang != "" {
+		v.languages[user] = lang
+		return lang
+	}
+
+	return v.languages[user]
+}
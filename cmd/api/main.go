@@ -2,31 +2,137 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
-	"unicode"
 
 	"github.com/gempir/go-twitch-irc/v4"
+	"github.com/llumus/lulis/internal/action"
+	"github.com/llumus/lulis/internal/cache"
+	cachefile "github.com/llumus/lulis/internal/cache/file"
+	"github.com/llumus/lulis/internal/conversation/file"
+	"github.com/llumus/lulis/internal/cost"
+	"github.com/llumus/lulis/internal/embedding"
+	embeddingopenai "github.com/llumus/lulis/internal/embedding/openai"
+	"github.com/llumus/lulis/internal/experiment"
+	"github.com/llumus/lulis/internal/export"
+	exportffmpeg "github.com/llumus/lulis/internal/export/ffmpeg"
 	"github.com/llumus/lulis/internal/fs/s3"
-	"github.com/llumus/lulis/internal/gpt/openai"
+	"github.com/llumus/lulis/internal/gpt"
+	"github.com/llumus/lulis/internal/gpt/fallback"
+	interstitialffmpeg "github.com/llumus/lulis/internal/interstitial/ffmpeg"
+	"github.com/llumus/lulis/internal/job"
+	"github.com/llumus/lulis/internal/knowledge"
+	"github.com/llumus/lulis/internal/knowledge/bm25"
+	"github.com/llumus/lulis/internal/language"
+	"github.com/llumus/lulis/internal/locale"
+	mixerffmpeg "github.com/llumus/lulis/internal/mixer/ffmpeg"
 	"github.com/llumus/lulis/internal/mixer/replicate"
+	"github.com/llumus/lulis/internal/moderation"
+	moderationopenai "github.com/llumus/lulis/internal/moderation/openai"
+	"github.com/llumus/lulis/internal/moderation/rules"
+	twitchmoderation "github.com/llumus/lulis/internal/moderation/twitch"
+	"github.com/llumus/lulis/internal/persona"
 	"github.com/llumus/lulis/internal/queue/memory"
+	"github.com/llumus/lulis/internal/scene"
+	stitchffmpeg "github.com/llumus/lulis/internal/stitch/ffmpeg"
+	"github.com/llumus/lulis/internal/stream"
 	"github.com/llumus/lulis/internal/stream/ffmpeg"
+	"github.com/llumus/lulis/internal/stream/layout"
+	"github.com/llumus/lulis/internal/thumbnail"
+	thumbnailffmpeg "github.com/llumus/lulis/internal/thumbnail/ffmpeg"
+	"github.com/llumus/lulis/internal/topics"
 	"github.com/llumus/lulis/internal/tts/elevenlabs"
 	"github.com/sirupsen/logrus"
 )
 
 var log = logrus.New()
 
-// healthCheckHandler is a simple HTTP handler function which writes a response used for cloud deploys
-func healthCheckHandler(w http.ResponseWriter, _ *http.Request) {
-	_, _ = fmt.Fprintf(w, "OK")
+// healthCheckHandler is a simple HTTP handler function which writes a response used for cloud deploys, with a 503
+// when the stream is not running
+func healthCheckHandler(streamer stream.Stream) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if !streamer.Status().Running {
+			http.Error(w, "Stream down", http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "OK")
+	}
+}
+
+// statusHandler writes the stream status, with a 503 when the stream is not running
+func statusHandler(streamer stream.Stream) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		status := streamer.Status()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Running {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(status)
+	}
+}
+
+// jobsHandler lists the pending and the latest finished jobs with their metadata
+func jobsHandler(tracker *job.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tracker.List())
+	}
+}
+
+// experimentsHandler writes the chat engagement of every prompt variant
+func experimentsHandler(experiments *experiment.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(experiments.Stats())
+	}
+}
+
+// promptVars are the variables of the persona prompt templates for the viewer, now
+func promptVars(streamer stream.Stream, chatTopics *topics.Pool, viewer string) gpt.Vars {
+	return gpt.Vars{
+		Viewer: viewer,
+		Topic:  chatTopics.Current(),
+		Uptime: streamer.Status().Uptime.Truncate(time.Minute),
+		Now:    time.Now(),
+	}
+}
+
+// llmHandler writes the circuit breaker state of every LLM provider
+func llmHandler(providers *fallback.Fallback) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(providers.Status())
+	}
+}
+
+// clipsHandler lists the played videos with their thumbnails and previews
+func clipsHandler(w http.ResponseWriter, _ *http.Request) {
+	type clip struct {
+		Video string `json:"video"`
+		thumbnail.Images
+	}
+
+	mutex.Lock()
+	clips := make([]clip, 0, len(playedVideos))
+	for _, video := range playedVideos {
+		clips = append(clips, clip{Video: video, Images: clipImages[video]})
+	}
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(clips)
 }
 
 // slotCount is a knob to control the number of files in the tmp folder and cache size for the workload
@@ -44,9 +150,72 @@ const queuesThroughput = 3 * time.Second
 // restartInterval is a knob to control the interval between stream restarts, necessary because of FFMPEG CPU overhead on shared vCPUs
 const restartInterval = 7 * time.Hour
 
+// conversationWindow is a knob to control how many exchanges with a viewer are remembered word by word, older ones are summarized
+const conversationWindow = 4
+
+// autoDialogueInterval is a knob to control the interval between automatic dialogues when there are several personas
+const autoDialogueInterval = 90 * time.Minute
+
+// debateCommand is the chat command to ask for a dialogue between the personas about a topic
+const debateCommand = "!debate "
+
+// personaReloadInterval is a knob to control how often the persona files are checked for changes
+const personaReloadInterval = 30 * time.Second
+
+// rulesReloadInterval is a knob to control how often the moderation rules file is checked for changes
+const rulesReloadInterval = 30 * time.Second
+
+// stableStreamInterval is a knob to control how long the stream has to run for its failures to be forgotten
+const stableStreamInterval = time.Minute
+
 // autoQuestionGenerationInterval is a knob to control the interval between automatic question generation
 const autoQuestionGenerationInterval = 60 * time.Minute
 
+// topicRecencyWindow is a knob to control how long a topic is not picked again for the automatic questions and
+// dialogues once it was covered, it weighs less for another window after that
+const topicRecencyWindow = 12 * time.Hour
+
+// savingAnswerRatio is a knob to control how much shorter the answers are once the soft limit of the budget is
+// reached
+const savingAnswerRatio = 0.5
+
+// savingCacheRatio is a knob to control how much less similar a question can be to replay a cached clip once the
+// soft limit of the budget is reached
+const savingCacheRatio = 0.9
+
+// defaultFaceCenter is a knob to control the horizontal position of the face in the vertical exports when it is not
+// set, from 0 (left) to 1 (right)
+const defaultFaceCenter = 0.5
+
+// defaultAnswerMaxDuration is a knob to control how long an answer can take to be spoken, longer ones cost more
+// voice and lip sync and stall the queue
+const defaultAnswerMaxDuration = 90 * time.Second
+
+// localesReloadInterval is a knob to control how often the translations of the chat messages are checked for changes
+const localesReloadInterval = time.Minute
+
+// knowledgeReloadInterval is a knob to control how often the knowledge base files are checked for changes
+const knowledgeReloadInterval = time.Minute
+
+// knowledgeMinScore is a knob to control the BM25 score a passage needs to be added to the prompt
+const knowledgeMinScore = 1.0
+
+// answerCacheSize is a knob to control how many answer clips are kept for the repeated questions
+const answerCacheSize = 256
+
+// defaultAnswerCacheMaxAge is a knob to control how long an answer can be replayed before the facts get stale
+const defaultAnswerCacheMaxAge = 30 * 24 * time.Hour
+
+// defaultEmbeddingSimilarity and defaultWordsSimilarity are the thresholds for a question to be the same as a cached
+// one, by the cosine of their embeddings or by the words they share
+const (
+	defaultEmbeddingSimilarity = 0.92
+	defaultWordsSimilarity     = 0.8
+)
+
+// exportTimeout is a knob to control how long the vertical export or thumbnails of a video can take
+const exportTimeout = 5 * time.Minute
+
 var (
 	// mutex for thread-safe access to playedVideos
 	mutex sync.Mutex
@@ -54,6 +223,12 @@ var (
 	// playedVideos to keep track of played videos
 	playedVideos []string = make([]string, 0, slotCount)
 
+	// cancelPlayingVideo cancels the PlayLatest of the video playing, nil when nothing is playing
+	cancelPlayingVideo context.CancelFunc
+
+	// clipImages to keep track of the thumbnail and preview of each video
+	clipImages = make(map[string]thumbnail.Images, slotCount)
+
 	// messageTimer timer to send a random cached video
 	messageTimer = time.NewTimer(autoPlayInterval)
 
@@ -62,6 +237,9 @@ var (
 
 	// questionTimer timer to generate a question
 	questionTimer = time.NewTimer(autoQuestionGenerationInterval)
+
+	// dialogueTimer timer to start a dialogue between personas
+	dialogueTimer = time.NewTimer(autoDialogueInterval)
 )
 
 func main() {
@@ -77,16 +255,116 @@ func main() {
 	var awsBucket = os.Getenv("AWS_BUCKET_NAME")
 	var awsBaseUrl = os.Getenv("AWS_BUCKET_BASE_URL")
 	var faceVideoUrl = os.Getenv("FACE_VIDEO_URL")
+	var personasPath = os.Getenv("PERSONAS_PATH")
+	var streamDestinationsPath = os.Getenv("STREAM_DESTINATIONS_PATH")
+	var streamLayoutPath = os.Getenv("STREAM_LAYOUT_PATH")
+	var sceneManifestPath = os.Getenv("SCENE_MANIFEST_PATH")
+	var interstitialFont = os.Getenv("INTERSTITIAL_FONT_PATH")
+	var previewFormat = os.Getenv("PREVIEW_FORMAT")
+	var verticalExport = os.Getenv("VERTICAL_EXPORT") == "true"
+	var streamAnswers = os.Getenv("STREAM_ANSWERS") == "true"
+	var answerCache = os.Getenv("ANSWER_CACHE") == "true"
+	var answerCacheThreshold, _ = strconv.ParseFloat(os.Getenv("ANSWER_CACHE_THRESHOLD"), 64)
+	var answerCacheMaxAge, _ = time.ParseDuration(os.Getenv("ANSWER_CACHE_MAX_AGE"))
+	var embeddingBaseUrl = os.Getenv("EMBEDDING_BASE_URL")
+	var embeddingApiKey = os.Getenv("EMBEDDING_API_KEY")
+	var embeddingModel = os.Getenv("EMBEDDING_MODEL")
+	var knowledgePath = os.Getenv("KNOWLEDGE_PATH")
+	var costPricesPath = os.Getenv("COST_PRICES_PATH")
+	var actionNames = os.Getenv("ACTIONS")
+	var overlaysPath = os.Getenv("OVERLAYS_PATH")
+	var localesPath = os.Getenv("LOCALES_PATH")
+	var chatLanguage = os.Getenv("CHAT_LANGUAGE")
+	var budgetSoftLimit, _ = strconv.ParseFloat(os.Getenv("BUDGET_SOFT_LIMIT"), 64)
+	var budgetHardLimit, _ = strconv.ParseFloat(os.Getenv("BUDGET_HARD_LIMIT"), 64)
+	var budgetReset, _ = time.ParseDuration(os.Getenv("BUDGET_RESET"))
+	var budgetStillImage = os.Getenv("BUDGET_STILL_IMAGE_PATH")
+	var budgetAudioOnly = os.Getenv("BUDGET_AUDIO_ONLY") != "false"
+	var verticalExportLogo = os.Getenv("VERTICAL_EXPORT_LOGO_PATH")
+	var verticalExportFont = os.Getenv("VERTICAL_EXPORT_FONT_PATH")
+	var verticalExportFaceCenter, verticalExportFaceCenterErr = strconv.ParseFloat(os.Getenv("VERTICAL_EXPORT_FACE_CENTER"), 64)
+	var moderationProvider = os.Getenv("MODERATION")
+	var moderationThresholdsPath = os.Getenv("MODERATION_THRESHOLDS_PATH")
+	var moderationRulesPath = os.Getenv("MODERATION_RULES_PATH")
+	var moderationAlertWebhook = os.Getenv("MODERATION_ALERT_WEBHOOK_URL")
+	var twitchAppClientId = os.Getenv("TWITCH_APP_CLIENT_ID")
+	var twitchModeratorId = os.Getenv("TWITCH_MODERATOR_ID")
+	var answerMaxDuration, _ = time.ParseDuration(os.Getenv("ANSWER_MAX_DURATION"))
+	var llmProvidersPath = os.Getenv("LLM_PROVIDERS_PATH")
+	var llmTemperature, _ = strconv.ParseFloat(os.Getenv("LLM_TEMPERATURE"), 64)
+	var llmMaxTokens, _ = strconv.Atoi(os.Getenv("LLM_MAX_TOKENS"))
+	// llm is the single LLM_* provider, only built without LLM_PROVIDERS_PATH
+	var llm = func() llmConfig {
+		return llmConfig{
+			Provider:    os.Getenv("LLM_PROVIDER"),
+			BaseURL:     os.Getenv("LLM_BASE_URL"),
+			APIKey:      os.Getenv("LLM_API_KEY"),
+			Model:       os.Getenv("LLM_MODEL"),
+			BudgetModel: os.Getenv("BUDGET_LLM_MODEL"),
+			Temperature: llmTemperature,
+			MaxTokens:   llmMaxTokens,
+			Timeout:     os.Getenv("LLM_TIMEOUT"),
+		}
+	}
+
+	if answerMaxDuration == 0 {
+		answerMaxDuration = defaultAnswerMaxDuration
+	}
 
-	gpt := openai.NewOpenAI(openAiKey)
+	// an unset face position parses as 0, the left edge, the face is centered instead
+	if verticalExportFaceCenterErr != nil {
+		verticalExportFaceCenter = defaultFaceCenter
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// every provider call made with the context is accounted in the ledger
+	ledger := loadLedger(filepath.Join(basePath, "tmp", "costs.jsonl"), costPricesPath)
+	ctx = cost.NewContext(ctx, ledger)
+
+	if localesPath == "" {
+		localesPath = filepath.Join(basePath, "assets", "locales")
+	}
+
+	if chatLanguage == "" {
+		chatLanguage = "en"
+	}
+
+	// the chat messages of the bot are told in the language of the viewer, the broadcast ones in the chat language
+	texts, err := locale.NewCatalog(localesPath, chatLanguage, chatTexts)
+	if err != nil {
+		log.Fatalf("Error loading locales: %v", err)
+	}
+	go texts.Watch(ctx, localesReloadInterval)
+	viewers := newViewerLanguages()
+
+	if personasPath == "" {
+		personasPath = filepath.Join(basePath, "assets", "personas")
+	}
+
+	personas, err := persona.NewStore(personasPath)
+	if err != nil {
+		log.Fatalf("Error loading personas: %v", err)
+	}
+	go personas.Watch(ctx, personaReloadInterval)
+
+	llmProviders := loadLLM(llmProvidersPath, llm, openAiKey)
+	assistant := gpt.NewAssistant(llmProviders, answerMaxDuration)
 	fs := s3.NewFileSystem(awsBucket, basePath, slotCount)
 	tts := elevenlabs.NewElevenLabs(elevenLabsKey, basePath, elevenLabsVoiceId, http.DefaultClient, fs)
-	stream := ffmpeg.NewStream(twitchStreamKey, filepath.Join(basePath, "tmp", "playlist.txt"))
+	streamLayout := loadLayout(streamLayoutPath)
+	streamer := ffmpeg.NewStream(loadDestinations(streamDestinationsPath, twitchStreamKey), filepath.Join(basePath, "tmp", "playlist.txt"), streamLayout)
 	mixer := replicate.NewMixer(replicateKey, awsBaseUrl, faceVideoUrl, http.DefaultClient, fs)
+	thumbnails := thumbnailffmpeg.NewGenerator(previewFormat, fs)
 
 	// Create a server instance
 	server := &http.Server{Addr: ":" + port}
-	http.HandleFunc("/", healthCheckHandler)
+	http.HandleFunc("/", healthCheckHandler(streamer))
+	http.HandleFunc("/status", statusHandler(streamer))
+	http.HandleFunc("/clips", clipsHandler)
+	http.HandleFunc("/llm", llmHandler(llmProviders))
+	http.HandleFunc("/costs", costsHandler(ledger))
 
 	go func() {
 		fmt.Println("Server is running on port " + port)
@@ -96,30 +374,54 @@ func main() {
 	}()
 
 	go func() {
-		for {
+		var attempts int
+		for ctx.Err() == nil {
 			log.Println("Starting stream...")
-			err := stream.StartStream()
-			if err != nil {
-				log.Println("Error starting stream:", err)
+			started := time.Now()
+			err := streamer.StartStream(ctx)
+			if err == nil {
+				// stopped on purpose, restart right away
+				attempts = 0
+				time.Sleep(queuesThroughput)
+				continue
 			}
-			time.Sleep(queuesThroughput)
+
+			log.Println("Error starting stream:", err)
+			if time.Since(started) > stableStreamInterval {
+				attempts = 0
+			}
+			attempts++
+			time.Sleep(stream.DefaultReconnectPolicy.Delay(attempts))
 		}
 	}()
 
 	videoQueue := memory.NewQueue()
 	go func() {
-		for {
+		for ctx.Err() == nil {
 			video, ok := videoQueue.Dequeue()
 			if ok {
 				log.Infof("Video from queue: %s", video)
 
-				err := stream.PlayLatest(video)
+				playCtx, cancel := context.WithCancel(ctx)
+				setCancelPlaying(cancel)
+				var err error
+				chunks, isSequence := takeSequence(video)
+				if isSequence {
+					// the stitched answer is added to the played videos by the pipeline
+					err = streamer.PlaySequence(playCtx, chunks)
+				} else {
+					err = streamer.PlayLatest(playCtx, video)
+				}
+				setCancelPlaying(nil)
+				cancel()
 				if err != nil {
 					log.Errorf("Error switching video: %v", err)
 					continue
 				}
 
-				addPlayedVideo(video)
+				if !isSequence {
+					addPlayedVideo(video)
+				}
 			}
 			time.Sleep(queuesThroughput)
 		}
@@ -127,58 +429,188 @@ func main() {
 
 	client := twitch.NewClient(twitchChannelName, twitchClientId)
 	msgQueue := memory.NewQueue()
-	go func() {
-		ctx := context.Background()
-		for {
-			message, ok := msgQueue.Dequeue()
-			if ok {
-				log.Debugf("Message from queue: %s", message)
 
-				if containsBannedWord(message) {
-					log.Warnf("Banned word detected in message: %s", message)
-					client.Say(twitchChannelName, "Sorry, I can't say that.")
-					continue
-				}
+	experiments, err := experiment.NewRecorder(filepath.Join(basePath, "tmp", "experiments.jsonl"))
+	if err != nil {
+		log.Fatalf("Error loading experiments: %v", err)
+	}
+	http.HandleFunc("/experiments", experimentsHandler(experiments))
 
-				answer, err := gpt.GenerateResponse(ctx, message)
-				if err != nil {
-					log.Println("Error generating response:", err)
-					continue
-				}
+	guard := loadGuard(ledger, cost.Limits{Soft: budgetSoftLimit, Hard: budgetHardLimit, Reset: budgetReset}, texts, func(message string) {
+		client.Say(twitchChannelName, message)
+	})
+	http.HandleFunc("/metrics", metricsHandler(ledger, guard))
 
-				log.Infof("Generated response for: %s", answer)
-				log.Infof("Generating audio for: %s", answer)
+	if moderationRulesPath == "" {
+		moderationRulesPath = filepath.Join(basePath, "assets", "moderation_rules.json")
+	}
 
-				fsKey, err := tts.GenerateAudio(ctx, answer)
-				if err != nil {
-					log.Println("Error generating audio:", err)
-					continue
-				}
+	moderationRules, err := rules.NewEngine(moderationRulesPath)
+	if err != nil {
+		log.Fatalf("Error loading moderation rules: %v", err)
+	}
+	go moderationRules.Watch(ctx, rulesReloadInterval)
+
+	chatRules := &chatModeration{
+		rules:      moderationRules,
+		webhookURL: moderationAlertWebhook,
+		texts:      texts,
+		say: func(message string) {
+			client.Say(twitchChannelName, message)
+		},
+	}
 
-				client.Say(twitchChannelName, "Almost ready...")
+	if twitchAppClientId != "" && twitchModeratorId != "" {
+		chatRules.timeouts = twitchmoderation.NewModeration(twitchAppClientId, twitchClientId, twitchModeratorId, http.DefaultClient)
+	}
 
-				log.Infof("Generated audio: %s", fsKey)
-				log.Infof("Generating lip sync for: %s", answer)
+	// chatTopics follows the chat for the automatic questions and dialogues
+	chatTopics := topics.NewPool(topicRecencyWindow)
 
-				videoLocalPath, err := mixer.GenerateLipSyncVideo(ctx, fsKey)
-				if err != nil {
-					log.Println("Error generating video:", err)
-					continue
-				}
+	tracker := job.NewTracker()
+	http.HandleFunc("/jobs", jobsHandler(tracker))
+	idle := newIdleLoop(streamer, filepath.Join(basePath, "tmp"))
 
-				client.Say(twitchChannelName, "Anytime now...")
+	if sceneManifestPath == "" {
+		sceneManifestPath = filepath.Join(basePath, "assets", "scenes.json")
+	}
 
-				log.Infof("Generated video: %s", videoLocalPath)
-				log.Infof("Sending video to queue: %s", videoLocalPath)
+	manifest, err := scene.LoadManifest(sceneManifestPath, filepath.Join(basePath, "tmp"))
+	if err != nil {
+		log.Warnf("Scenes disabled, keeping the default idle loop: %v", err)
+	} else {
+		go idle.rotateScenes(scene.NewScheduler(manifest), manifest.RotationInterval(), msgQueue, videoQueue)
+	}
 
-				videoQueue.Enqueue(videoLocalPath)
-				messageTimer.Reset(autoPlayInterval)
-				questionTimer.Reset(autoQuestionGenerationInterval)
+	feeds := newLayoutFeeds(streamLayout)
+	go feeds.followQuestions(tracker)
+
+	go idle.showInterstitials(interstitialffmpeg.NewRenderer(filepath.Join(basePath, "tmp"), interstitialFont), tracker)
+
+	memory, err := file.NewMemory(filepath.Join(basePath, "tmp", "conversations"), conversationWindow, assistant)
+	if err != nil {
+		log.Fatalf("Error creating conversation memory: %v", err)
+	}
+
+	var exporter export.Exporter
+	if verticalExport {
+		exporter = exportffmpeg.NewExporter(basePath, verticalExportLogo, verticalExportFont, verticalExportFaceCenter, fs)
+	}
+
+	var answers cache.Cache
+	if answerCache {
+		var embedder embedding.Embedder
+		if embeddingModel != "" {
+			if embeddingApiKey == "" {
+				embeddingApiKey = openAiKey
 			}
+			embedder = embeddingopenai.NewEmbedder(embeddingBaseUrl, embeddingApiKey, embeddingModel, http.DefaultClient)
+		}
 
-			time.Sleep(queuesThroughput)
+		if answerCacheThreshold == 0 {
+			answerCacheThreshold = defaultWordsSimilarity
+			if embedder != nil {
+				answerCacheThreshold = defaultEmbeddingSimilarity
+			}
+		}
+
+		if answerCacheMaxAge == 0 {
+			answerCacheMaxAge = defaultAnswerCacheMaxAge
 		}
-	}()
+
+		answers, err = cachefile.NewCache(filepath.Join(basePath, "tmp"), answerCacheSize, answerCacheMaxAge, embedder)
+		if err != nil {
+			log.Fatalf("Error loading answer cache: %v", err)
+		}
+	}
+
+	if knowledgePath == "" {
+		knowledgePath = filepath.Join(basePath, "assets", "knowledge")
+	}
+
+	// the knowledge base is optional, a missing folder disables it
+	var retriever knowledge.Retriever
+	if _, err := os.Stat(knowledgePath); err == nil {
+		index, err := bm25.NewIndex(knowledgePath, knowledgeMinScore)
+		if err != nil {
+			log.Fatalf("Error loading knowledge base: %v", err)
+		}
+		go index.Watch(ctx, knowledgeReloadInterval)
+		retriever = index
+	}
+
+	// the actions are only offered to the personas when the operator whitelists them
+	var actions *action.Registry
+	if actionNames != "" {
+		if overlaysPath == "" {
+			overlaysPath = filepath.Join(basePath, "assets", "overlays")
+		}
+
+		actions = action.NewRegistry(strings.Split(actionNames, ","))
+		if manifest != nil {
+			actions.Register(sceneAction(idle, manifest, filepath.Join(basePath, "tmp")))
+		}
+		if images := newOverlay(streamLayout, overlaysPath); images != nil {
+			actions.Register(images.action())
+		}
+		if answers != nil {
+			actions.Register(replayAction(answers, answerCacheThreshold, videoQueue))
+		}
+	}
+
+	jobs := &pipeline{
+		gpt:            assistant,
+		tts:            tts,
+		mixer:          mixer,
+		stitcher:       stitchffmpeg.NewStitcher(filepath.Join(basePath, "tmp"), slotCount),
+		clips:          newClipFiles(slotCount),
+		personas:       personas,
+		memory:         memory,
+		tracker:        tracker,
+		videoQueue:     videoQueue,
+		thumbnails:     thumbnails,
+		exporter:       exporter,
+		moderator:      loadModerator(moderationProvider, moderationThresholdsPath, openAiKey),
+		rules:          chatRules,
+		streaming:      streamAnswers,
+		texts:          texts,
+		cache:          answers,
+		cacheThreshold: answerCacheThreshold,
+		knowledge:      retriever,
+		experiments:    experiments,
+		actions:        actions,
+		ledger:         ledger,
+		guard:          guard,
+		saving: cost.Saving{
+			AnswerRatio: savingAnswerRatio,
+			CacheRatio:  savingCacheRatio,
+		},
+		vars: func(viewer string) gpt.Vars {
+			return promptVars(streamer, chatTopics, viewer)
+		},
+		say: func(message string) {
+			client.Say(twitchChannelName, message)
+		},
+	}
+	if budgetAudioOnly {
+		jobs.stills = mixerffmpeg.NewMixer(filepath.Join(basePath, "tmp"), awsBaseUrl, faceVideoUrl, budgetStillImage, slotCount)
+	}
+
+	// the poll is moderated by the pipeline, its action is offered once the pipeline exists
+	poll := &chatPoll{
+		rules:    chatRules,
+		moderate: jobs.moderate,
+		texts:    texts,
+		say: func(message string) {
+			client.Say(twitchChannelName, message)
+		},
+	}
+	if actions != nil {
+		actions.Register(poll.action())
+	}
+
+	go jobs.run(ctx, msgQueue)
+	go logStreamEvents(streamer, jobs.aired)
 
 	go func() {
 		for {
@@ -186,7 +618,7 @@ func main() {
 			case <-messageTimer.C:
 				// Timer expired, send a random cached video
 				if len(playedVideos) > 0 {
-					client.Say(twitchChannelName, "Playing a previous question...")
+					client.Say(twitchChannelName, texts.Text("", "playing_previous"))
 
 					randomIndex := rand.Intn(len(playedVideos))
 					randomVideo := playedVideos[randomIndex]
@@ -194,26 +626,71 @@ func main() {
 				}
 				messageTimer.Reset(autoPlayRecurrentInterval)
 			case <-restartTimer.C:
-				// Timer expired, restart the stream
-				client.Say(twitchChannelName, "Back in some seconds!")
-				err := stream.StopStream()
+				// Timer expired, restart the stream, the video playing would start over after the restart
+				client.Say(twitchChannelName, texts.Text("", "restarting"))
+				cancelPlaying()
+				err := streamer.StopStream()
 				if err != nil {
 					log.Errorf("Error stopping stream: %v", err)
 				}
 				restartTimer.Reset(restartInterval)
 			case <-questionTimer.C:
 				// Timer expired, generate a question
-				ctx := context.Background()
-				question, err := gpt.GenerateQuestion(ctx)
+				if budgetSpent(guard) {
+					questionTimer.Reset(autoQuestionGenerationInterval)
+					continue
+				}
+
+				all := personas.All()
+				p := all[rand.Intn(len(all))]
+				brief := chatTopics.Brief(p.Topics, p.TopicWeights, p.Trigger)
+				log.Infof("Generating a question about %q, trending %v", brief.Topic, brief.Trending)
+
+				vars := promptVars(streamer, chatTopics, "")
+				vars.Topic = brief.Topic
+
+				question, err := assistant.GenerateQuestion(gpt.NewVarsContext(topics.NewContext(persona.NewContext(ctx, p), brief), vars))
 				if err != nil {
 					log.Println("Error generating question:", err)
 					continue
 				}
 
 				log.Infof("Generated question: %s", question)
+
+				// the question is steered by the chat topics, it is moderated like the answers before the chat
+				if question, err = chatRules.check("generated question", question, "", ""); err == nil {
+					err = jobs.moderate(ctx, "generated question", question)
+				}
+				if err != nil {
+					log.Warnf("Dropping generated question: %v", err)
+					questionTimer.Reset(autoQuestionGenerationInterval)
+					continue
+				}
+
 				client.Say(twitchChannelName, question)
-				msgQueue.Enqueue(question)
+				chatTopics.AddQuestion(question)
+				msgQueue.Enqueue(tracker.Create(question, "", p.Name).ID)
 				questionTimer.Reset(autoQuestionGenerationInterval)
+			case <-dialogueTimer.C:
+				// Timer expired, start a dialogue between the personas
+				dialogueTimer.Reset(autoDialogueInterval)
+				if budgetSpent(guard) {
+					continue
+				}
+
+				all := personas.All()
+				if len(all) < 2 || len(all[0].Topics) == 0 {
+					continue
+				}
+
+				topic := chatTopics.Pick(all[0].Topics, all[0].TopicWeights)
+				if topic == "" {
+					continue
+				}
+
+				chatTopics.AddQuestion(topic)
+				log.Infof("Starting a dialogue about: %s", topic)
+				msgQueue.Enqueue(tracker.CreateDialogue(topic, "", dialoguePersonas(all)).ID)
 			}
 		}
 	}()
@@ -221,22 +698,199 @@ func main() {
 	client.Join(twitchChannelName)
 	client.OnPrivateMessage(func(message twitch.PrivateMessage) {
 		log.Infof("Message received: %s", message.Message)
-		if strings.HasPrefix(message.Message, "Lula, ") {
-			log.Infof("Message to the queue: %s", message.Message)
-			msgQueue.Enqueue(message.Message + " - " + message.User.Name)
-			client.Say(message.Channel, "We are processing your request "+message.User.Name+", please wait a minute or two.")
+		experiments.Message(message.User.Name)
+		// the message is moderated with the rules of its own language, all of them when it is unknown, and the bot
+		// answers in the language of the viewer, the latest one detected when the message is too short to tell
+		viewerLang := language.Detect(message.Message)
+		answerLang := viewers.detect(message.User.Name, message.Message)
+		// the refused messages are kept out of the feeds and the topics, the others have their replacements
+		if text, ok := chatRules.clean(message.Message, viewerLang); ok {
+			feeds.addChatMessage(message.User.DisplayName, text)
+			chatTopics.AddMessage(message.User.DisplayName, text)
+		}
+
+		if poll.vote(message.User.Name, message.Message) {
+			return
+		}
+
+		if topic, ok := strings.CutPrefix(message.Message, debateCommand); ok {
+			all := personas.All()
+			if len(all) < 2 {
+				client.Say(message.Channel, texts.Text(answerLang, "debate_needs_two", "user", message.User.Name))
+				return
+			}
+
+			if _, ok := chatRules.checkMessage(message, viewerLang, answerLang); !ok {
+				return
+			}
+
+			if budgetSpent(guard) {
+				client.Say(message.Channel, texts.Text(answerLang, "no_more_debates", "user", message.User.Name, "time", guard.NextReset().Format("15:04")))
+				return
+			}
+
+			log.Infof("Debate to the queue: %s", topic)
+			chatTopics.AddQuestion(topic)
+			msgQueue.Enqueue(tracker.CreateDialogue(strings.TrimSpace(topic), message.User.Name, dialoguePersonas(all)).ID)
+			client.Say(message.Channel, texts.Text(answerLang, "debate_preparing", "user", message.User.Name))
+		} else if p, ok := personas.Match(message.Message); ok {
+			// the messages about the answer are told in its language
+			answerLang = p.AnswerLanguage(answerLang)
+			question, ok := chatRules.checkMessage(message, viewerLang, answerLang)
+			if !ok {
+				return
+			}
+
+			if budgetSpent(guard) {
+				client.Say(message.Channel, texts.Text(answerLang, "no_more_questions", "user", message.User.Name, "time", guard.NextReset().Format("15:04")))
+				return
+			}
+
+			log.Infof("Message to the queue for %s in %q: %s", p.Name, answerLang, question)
+			chatTopics.AddQuestion(question)
+			j := tracker.Create(question, message.User.Name, p.Name)
+			tracker.SetMetadata(j.ID, viewerLanguageMetadata, viewerLang)
+			if answerLang != "" {
+				tracker.SetMetadata(j.ID, languageMetadata, answerLang)
+			}
+			msgQueue.Enqueue(j.ID)
+			client.Say(message.Channel, texts.Text(answerLang, "processing", "user", message.User.Name))
 		} else {
 			log.Infof("Message not for me: %s", message.Message)
-			client.Say(message.Channel, "To talk to Lula, a message have to start with 'Lula, '")
+			client.Say(message.Channel, texts.Text(answerLang, "not_for_me", "triggers", triggers(personas.All())))
 		}
 	})
 
-	err := client.Connect()
-	if err != nil {
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down...")
+		_ = client.Disconnect()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	err = client.Connect()
+	if err != nil && err != twitch.ErrClientDisconnected {
 		panic(err)
 	}
 }
 
+// logStreamEvents to follow the stream lifecycle in the logs
+func logStreamEvents(streamer stream.Stream, onItemStarted func(item string)) {
+	for event := range streamer.Events() {
+		if event.Type == stream.EventItemStarted {
+			onItemStarted(event.Item)
+		}
+
+		switch event.Type {
+		case stream.EventCrashed:
+			log.Errorf("Stream crashed: %v", event.Err)
+		case stream.EventDestinationAlert:
+			log.Errorf("ALERT destination %s keeps failing: %v", event.Item, event.Err)
+		case stream.EventDestinationDown:
+			log.Warnf("Destination %s down: %v", event.Item, event.Err)
+		case stream.EventItemStarted, stream.EventItemFinished:
+			log.Infof("Stream %s: %s", event.Type, event.Item)
+		default:
+			log.Infof("Stream %s", event.Type)
+		}
+	}
+}
+
+// loadDestinations to read the stream destinations file, defaults to the Twitch channel of the stream key
+func loadDestinations(path string, twitchStreamKey string) []stream.Destination {
+	if path == "" {
+		return []stream.Destination{{
+			Name: "twitch",
+			URL:  "rtmp://live.twitch.tv/app/" + twitchStreamKey,
+		}}
+	}
+
+	destinations, err := stream.LoadDestinations(path)
+	if err != nil {
+		log.Fatalf("Error loading stream destinations: %v", err)
+	}
+
+	return destinations
+}
+
+// loadModerator to create the moderator of the questions and answers, the OpenAI moderation endpoint by default
+func loadModerator(provider string, thresholdsPath string, openAiKey string) moderation.Moderator {
+	if provider == "off" {
+		log.Warnf("Moderation disabled")
+		return nil
+	}
+
+	if provider != "" && provider != "openai" {
+		log.Fatalf("Unknown moderation provider %s", provider)
+	}
+
+	thresholds := moderation.Thresholds{}
+	if thresholdsPath != "" {
+		var err error
+		if thresholds, err = moderation.LoadThresholds(thresholdsPath); err != nil {
+			log.Fatalf("Error loading moderation thresholds: %v", err)
+		}
+	}
+
+	return moderationopenai.NewModerator(openAiKey, thresholds, http.DefaultClient)
+}
+
+// loadLayout to read the stream layout file, nil streams the videos full frame
+func loadLayout(path string) *layout.Layout {
+	if path == "" {
+		return nil
+	}
+
+	l, err := layout.Load(path)
+	if err != nil {
+		log.Fatalf("Error loading stream layout: %v", err)
+	}
+
+	return l
+}
+
+// triggers to list the persona triggers for the chat help message
+func triggers(personas []*persona.Persona) string {
+	quoted := make([]string, 0, len(personas))
+	for _, p := range personas {
+		quoted = append(quoted, "'"+p.Trigger+"'")
+	}
+
+	return strings.Join(quoted, " or ")
+}
+
+// dialoguePersonas to pick the names of up to three random personas for a dialogue
+func dialoguePersonas(all []*persona.Persona) []string {
+	names := make([]string, 0, len(all))
+	for _, i := range rand.Perm(len(all)) {
+		names = append(names, all[i].Name)
+	}
+
+	if len(names) > 3 {
+		names = names[:3]
+	}
+
+	return names
+}
+
+// setCancelPlaying to keep the cancel function of the video playing
+func setCancelPlaying(cancel context.CancelFunc) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	cancelPlayingVideo = cancel
+}
+
+// cancelPlaying to stop waiting for the video playing and put the idle loop back
+func cancelPlaying() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if cancelPlayingVideo != nil {
+		cancelPlayingVideo()
+	}
+}
+
 // addPlayedVideo to add a video to the playedVideos slice
 func addPlayedVideo(videoPath string) {
 	mutex.Lock()
@@ -250,80 +904,34 @@ func addPlayedVideo(videoPath string) {
 	playedVideos = append(playedVideos, videoPath)
 }
 
-var bannedWords = []string{
-	"porn",
-	"nude",
-	"sexually",
-	"shit",
-	"damn",
-	"hell",
-	"kill",
-	"murder",
-	"hit",
-	"fight",
-	"cocaine",
-	"weed",
-	"meth",
-	"idiot",
-	"stupid",
-	"dumb",
-	"suicide",
-	"abuse",
-	"trauma",
-	"rape",
-	"ass",
-	"fuck",
-	"suck",
-	"bitch",
-	"crap",
-	"puta",
-	"caralho",
-	"sex",
-	"disability",
-	"disabilities",
-	"disorder",
-	"disorders",
-	"aprendizagem",
-	"replace",
-	"replaced",
-	"replacing",
-	"replaces",
-	"substitua",
-	"substituir",
-	"substituindo",
-	"\"",
-	"“",
-	"”",
-	"’",
-	"‘",
-	"''",
-	"``",
-	"\\",
-	"!*",
-}
+// generateThumbnails to generate the thumbnail and preview of a generated video, runs in the background
+func generateThumbnails(generator thumbnail.Generator, videoPath string) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
 
-// containsBannedWord checks the message for any banned words
-func containsBannedWord(message string) bool {
-	// Split the message into words
-	words := strings.FieldsFunc(message, func(r rune) bool {
-		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
-	})
-
-	// Check each word
-	for _, word := range words {
-		if isBannedWord(word) {
-			return true
-		}
+	images, err := generator.Generate(ctx, videoPath)
+	if err != nil {
+		log.Errorf("Error generating thumbnails for %s: %v", videoPath, err)
+		return
 	}
 
-	return false
+	mutex.Lock()
+	clipImages[videoPath] = images
+	mutex.Unlock()
+
+	log.Infof("Generated thumbnail %s and preview %s for %s", images.Thumbnail, images.Preview, videoPath)
 }
 
-func isBannedWord(word string) bool {
-	for _, banned := range bannedWords {
-		if strings.EqualFold(word, banned) {
-			return true
-		}
+// exportVertical to export the vertical highlight version of a generated video, runs in the background
+func exportVertical(exporter export.Exporter, videoPath string, metadata export.Metadata) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	key, err := exporter.Export(ctx, videoPath, metadata)
+	if err != nil {
+		log.Errorf("Error exporting vertical video %s: %v", videoPath, err)
+		return
 	}
-	return false
+
+	log.Infof("Exported vertical video: %s", key)
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v4"
+	"github.com/llumus/lulis/internal/language"
+	"github.com/llumus/lulis/internal/locale"
+	"github.com/llumus/lulis/internal/moderation/rules"
+	twitchmoderation "github.com/llumus/lulis/internal/moderation/twitch"
+)
+
+// alertTimeout is a knob to control how long posting a moderation alert can take
+const alertTimeout = 10 * time.Second
+
+// chatModeration applies the moderation rules to the chat messages and to the texts of the pipeline
+type chatModeration struct {
+	rules *rules.Engine
+	// timeouts is nil when the Twitch moderation api is not configured, the timeout rules only reject then
+	timeouts *twitchmoderation.Moderation
+	// webhookURL receives the alerts as {"content": ..., "text": ...}, Discord and Slack style, when set
+	webhookURL string
+	texts      *locale.Catalog
+	say        func(message string)
+}
+
+// checkMessage a chat message before it is queued with the rules of the language detected in the message, all of
+// them when it is unknown, returns the text to queue or false when it is refused, told in the language of the answer
+func (m *chatModeration) checkMessage(message twitch.PrivateMessage, viewerLang string, answerLang string) (string, bool) {
+	verdict := m.rules.Check(message.Message, language.Base(viewerLang))
+	m.report("message from "+message.User.Name, verdict)
+
+	if verdict.Action == rules.ActionTimeout && m.timeouts != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+		defer cancel()
+
+		reason := "moderation rule " + verdict.Matches[0].Rule
+		if err := m.timeouts.Timeout(ctx, message.RoomID, message.User.ID, verdict.Timeout, reason); err != nil {
+			log.Errorf("Error timing out %s: %v", message.User.Name, err)
+		}
+	}
+
+	if verdict.Refused() {
+		m.say(m.texts.Text(answerLang, "refused"))
+		return "", false
+	}
+
+	return verdict.Text, true
+}
+
+// clean a text for the prompts without reporting it, with the rules of its language, returns false when it is refused
+func (m *chatModeration) clean(text string, viewerLang string) (string, bool) {
+	verdict := m.rules.Check(text, language.Base(viewerLang))
+	return verdict.Text, !verdict.Refused()
+}
+
+// check a text of the pipeline with the rules of its language, all of them when it is unknown, returns the text with
+// the replacements or an error when it is refused, told in the language of the answer
+func (m *chatModeration) check(kind string, text string, textLang string, answerLang string) (string, error) {
+	verdict := m.rules.Check(text, language.Base(textLang))
+	m.report(kind, verdict)
+
+	if verdict.Refused() {
+		m.say(m.texts.Text(answerLang, "refused"))
+		return "", fmt.Errorf("%s refused by the moderation rules: %s", kind, verdict.Matches[0].Rule)
+	}
+
+	return verdict.Text, nil
+}
+
+// report the verdict in the logs, and to the moderators for the alert rules
+func (m *chatModeration) report(kind string, verdict rules.Verdict) {
+	if verdict.Action == "" {
+		return
+	}
+
+	var matches []string
+	alert := false
+	for _, match := range verdict.Matches {
+		matches = append(matches, fmt.Sprintf("%s (%s) %q", match.Rule, match.Action, match.Text))
+		alert = alert || match.Action == rules.ActionAlert
+	}
+
+	summary := fmt.Sprintf("Moderation %s on %s: %s", verdict.Action, kind, strings.Join(matches, ", "))
+	log.Warn(summary)
+
+	if alert && m.webhookURL != "" {
+		go m.alert(summary)
+	}
+}
+
+func (m *chatModeration) alert(summary string) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]string{"content": summary, "text": summary})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Errorf("Error creating moderation alert: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Errorf("Error sending moderation alert: %v", err)
+		return
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Errorf("Error sending moderation alert: status %d", resp.StatusCode)
+	}
+}
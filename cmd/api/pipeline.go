@@ -0,0 +1,617 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/action"
+	"github.com/llumus/lulis/internal/cache"
+	"github.com/llumus/lulis/internal/conversation"
+	"github.com/llumus/lulis/internal/cost"
+	"github.com/llumus/lulis/internal/experiment"
+	"github.com/llumus/lulis/internal/export"
+	"github.com/llumus/lulis/internal/gpt"
+	"github.com/llumus/lulis/internal/job"
+	"github.com/llumus/lulis/internal/knowledge"
+	"github.com/llumus/lulis/internal/language"
+	"github.com/llumus/lulis/internal/locale"
+	"github.com/llumus/lulis/internal/mixer"
+	"github.com/llumus/lulis/internal/moderation"
+	"github.com/llumus/lulis/internal/persona"
+	"github.com/llumus/lulis/internal/queue"
+	"github.com/llumus/lulis/internal/stitch"
+	"github.com/llumus/lulis/internal/thumbnail"
+	"github.com/llumus/lulis/internal/tts"
+)
+
+// memoryTimeout is a knob to control how long saving a conversation, including its summary, can take
+const memoryTimeout = 2 * time.Minute
+
+// knowledgePassages is a knob to control how many passages of the knowledge base can be added to a prompt
+const knowledgePassages = 3
+
+// languageMetadata is the job metadata key of the language of the answer
+const languageMetadata = "language"
+
+// viewerLanguageMetadata is the job metadata key of the language detected in the question, empty when unknown
+const viewerLanguageMetadata = "viewer_language"
+
+// providerMetadata is the job metadata key of the LLM provider that served the latest completion of the job
+const providerMetadata = "provider"
+
+// savingMetadata is the job metadata key marking the jobs made cheaper by the budget
+const savingMetadata = "saving"
+
+// actionTimeout is a knob to control how long the actions of an answer can take
+const actionTimeout = time.Minute
+
+// dialogueTurns is a knob to control the number of lines of a dialogue between personas
+const dialogueTurns = 6
+
+// pipeline turns the queued jobs into videos, from the gpt answer to the lip sync video in the video queue
+type pipeline struct {
+	gpt   gpt.GPT
+	tts   tts.TTS
+	mixer mixer.Mixer
+	// stills replaces the lip sync of the mixer when saving, nil to keep the lip sync
+	stills   mixer.Mixer
+	stitcher stitch.Stitcher
+	clips    *clipFiles
+	personas *persona.Store
+	memory   conversation.Memory
+	// moderator is nil when the moderation is disabled
+	moderator  moderation.Moderator
+	rules      *chatModeration
+	tracker    *job.Tracker
+	videoQueue queue.Queue
+	thumbnails thumbnail.Generator
+	// exporter is nil when the vertical export is disabled
+	exporter export.Exporter
+	// knowledge is nil when there is no knowledge base
+	knowledge knowledge.Retriever
+	// cache is nil when the answers are always generated
+	cache          cache.Cache
+	cacheThreshold float64
+	experiments    *experiment.Recorder
+	// actions is nil when the personas can't trigger actions
+	actions *action.Registry
+	// plans are the actions requested by the answers being generated, by job
+	plans sync.Map
+	// vars are the variables of the prompt templates for the viewer
+	vars func(viewer string) gpt.Vars
+	// ledger accounts the provider calls made in the background, after the job
+	ledger *cost.Ledger
+	// guard is nil when there is no budget, over its soft limit the jobs are made cheaper with saving
+	guard  *cost.Guard
+	saving cost.Saving
+	// streaming answers are spoken sentence by sentence while they are generated
+	streaming bool
+	texts     *locale.Catalog
+	say       func(message string)
+}
+
+// run to process the jobs of the queue until the context is done
+func (p *pipeline) run(ctx context.Context, msgQueue queue.Queue) {
+	for ctx.Err() == nil {
+		jobID, ok := msgQueue.Dequeue()
+		if ok {
+			j, found := p.tracker.Get(jobID)
+			if !found {
+				log.Warnf("Job %s not found", jobID)
+				continue
+			}
+
+			var err error
+			jobCtx := cost.WithJob(ctx, j.ID, j.User)
+			jobCtx = gpt.NewServedContext(jobCtx, func(provider string) {
+				p.tracker.SetMetadata(j.ID, providerMetadata, provider)
+			})
+			if p.guard != nil && p.guard.Level() >= cost.LevelSoft {
+				jobCtx = cost.WithSaving(jobCtx, p.saving)
+				p.tracker.SetMetadata(j.ID, savingMetadata, "true")
+			}
+			switch j.Kind {
+			case job.KindDialogue:
+				err = p.dialogue(jobCtx, j)
+			default:
+				err = p.answer(jobCtx, j)
+			}
+
+			if err != nil {
+				log.Errorf("Error processing job %s: %v", j.ID, err)
+				p.tracker.Update(j.ID, job.StatusFailed, err)
+				p.plans.Delete(j.ID)
+			}
+		}
+
+		time.Sleep(queuesThroughput)
+	}
+}
+
+func (p *pipeline) answer(ctx context.Context, j job.Job) error {
+	log.Debugf("Message from queue: %s", j.Message())
+
+	speaker := p.persona(j.Persona)
+	viewerLang, answerLang := p.language(j, speaker)
+	ctx = language.NewContext(persona.NewContext(ctx, speaker), answerLang)
+
+	message, err := p.rules.check("question", j.Message(), viewerLang, answerLang)
+	if err != nil {
+		return err
+	}
+
+	if err := p.moderate(ctx, "question", j.Question); err != nil {
+		return err
+	}
+
+	if answer, ok := p.replay(ctx, j, speaker); ok {
+		p.rememberTurn(j, speaker, answer)
+		return nil
+	}
+
+	if j.User != "" {
+		c, err := p.memory.Get(ctx, j.User)
+		if err != nil {
+			log.Errorf("Error reading conversation of %s: %v", j.User, err)
+		}
+		ctx = conversation.NewContext(ctx, c.With(speaker.Name))
+	}
+
+	ctx = p.retrieve(ctx, j, speaker)
+	ctx = p.prompt(ctx, j, speaker)
+	ctx = p.plan(ctx, j)
+
+	var answer string
+	if p.streaming {
+		answer, err = p.streamAnswer(ctx, j, message)
+	} else {
+		answer, err = p.generateAnswer(ctx, j, message)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	p.rememberTurn(j, speaker, answer)
+	return nil
+}
+
+// language detected in the question of the job, empty when unknown so all the moderation rules apply, and the
+// language of its answer, the one of the viewer when the persona speaks it, recorded on the job
+func (p *pipeline) language(j job.Job, speaker *persona.Persona) (string, string) {
+	viewerLang, ok := j.Metadata[viewerLanguageMetadata]
+	if !ok && j.User != "" {
+		viewerLang = language.Detect(cacheKey(speaker, j.Question))
+	}
+
+	// the chat may know the language of the viewer from their previous messages
+	answerLang := j.Metadata[languageMetadata]
+	if answerLang == "" {
+		answerLang = viewerLang
+	}
+
+	answerLang = speaker.AnswerLanguage(answerLang)
+	if language.Base(answerLang) != language.Base(speaker.Language) {
+		log.Infof("Answering job %s in %s", j.ID, language.Name(answerLang))
+	}
+
+	p.tracker.SetMetadata(j.ID, languageMetadata, answerLang)
+	return viewerLang, answerLang
+}
+
+// text of the chat in the language of the answer
+func (p *pipeline) text(ctx context.Context, key string, pairs ...string) string {
+	lang, _ := language.FromContext(ctx)
+	return p.texts.Text(lang, key, pairs...)
+}
+
+// retrieve the passages of the knowledge base relevant to the question, the sources are recorded on the job
+func (p *pipeline) retrieve(ctx context.Context, j job.Job, speaker *persona.Persona) context.Context {
+	if p.knowledge == nil {
+		return ctx
+	}
+
+	passages, err := p.knowledge.Retrieve(ctx, speaker.Name, cacheKey(speaker, j.Question), knowledgePassages)
+	if err != nil {
+		log.Errorf("Error retrieving knowledge for %q: %v", j.Question, err)
+		return ctx
+	}
+
+	if len(passages) == 0 {
+		return ctx
+	}
+
+	sources := knowledge.Sources(passages)
+	log.Infof("Retrieved %d passages for %q from %v", len(passages), j.Question, sources)
+	p.tracker.SetMetadata(j.ID, "sources", strings.Join(sources, ", "))
+
+	return knowledge.NewContext(ctx, passages)
+}
+
+// prompt the persona with the variables of its templates, and with the variant of the experiment assigned to the job
+func (p *pipeline) prompt(ctx context.Context, j job.Job, speaker *persona.Persona) context.Context {
+	if variant := p.experiments.Assign(speaker, j.ID, j.User); variant != "" {
+		p.tracker.SetMetadata(j.ID, "variant", variant)
+		ctx = persona.NewContext(ctx, speaker.WithVariant(variant))
+	}
+
+	return gpt.NewVarsContext(ctx, p.vars(j.User))
+}
+
+// plan the actions the answer of the job can request, they run once it airs
+func (p *pipeline) plan(ctx context.Context, j job.Job) context.Context {
+	if p.actions == nil {
+		return ctx
+	}
+
+	plan := p.actions.Plan()
+	p.plans.Store(j.ID, plan)
+	return action.NewContext(ctx, plan)
+}
+
+// act to run the actions requested by the answer of the job, in the background
+func (p *pipeline) act(j job.Job) {
+	value, ok := p.plans.LoadAndDelete(j.ID)
+	if !ok {
+		return
+	}
+
+	plan := value.(*action.Plan)
+	names := plan.Names()
+	if len(names) == 0 {
+		return
+	}
+
+	log.Infof("Running the actions %v of job %s", names, j.ID)
+	p.tracker.SetMetadata(j.ID, "actions", strings.Join(names, ", "))
+
+	current, _ := p.tracker.Get(j.ID)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+		defer cancel()
+
+		plan.Run(language.NewContext(persona.NewContext(ctx, p.persona(j.Persona)), current.Metadata[languageMetadata]))
+	}()
+}
+
+// rememberTurn to add the answer to the conversation of the viewer who asked, in the background
+func (p *pipeline) rememberTurn(j job.Job, speaker *persona.Persona, answer string) {
+	if j.User == "" {
+		return
+	}
+
+	go p.remember(j.User, conversation.Turn{
+		Persona:  speaker.Name,
+		Question: j.Question,
+		Answer:   answer,
+		Time:     time.Now(),
+	})
+}
+
+// replay the clip of a question close enough to the one of the job instead of generating a new one
+func (p *pipeline) replay(ctx context.Context, j job.Job, speaker *persona.Persona) (string, bool) {
+	if p.cache == nil {
+		return "", false
+	}
+
+	threshold := p.cacheThreshold
+	if saving, ok := cost.SavingFromContext(ctx); ok && saving.CacheRatio > 0 {
+		threshold *= saving.CacheRatio
+	}
+
+	lang, _ := language.FromContext(ctx)
+	match, ok, err := p.cache.Lookup(ctx, cacheScope(speaker, lang), cacheKey(speaker, j.Question), threshold)
+	if err != nil {
+		log.Errorf("Error looking up the answer cache: %v", err)
+		return "", false
+	}
+
+	if !ok {
+		return "", false
+	}
+
+	log.Infof("Replaying cached answer to %q for %q (similarity %.2f, %d hits)", match.Question, j.Question, match.Similarity, match.Hits)
+
+	if j.User != "" {
+		p.say(p.text(ctx, "replaying_answer", "user", j.User, "persona", speaker.Name))
+	}
+
+	p.videoQueue.Enqueue(match.Video)
+	p.tracker.Update(j.ID, job.StatusReady, nil)
+	messageTimer.Reset(autoPlayInterval)
+	questionTimer.Reset(autoQuestionGenerationInterval)
+
+	return match.Answer, true
+}
+
+// cacheAnswer to keep the clip of an answer for the next similar questions, runs in the background
+func (p *pipeline) cacheAnswer(j job.Job, videoLocalPath string, answer string) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	ctx = cost.WithJob(cost.NewContext(ctx, p.ledger), j.ID, j.User)
+
+	// the clip is replayed to other viewers, an answer calling the viewer by name would address them wrongly
+	if j.User != "" && strings.Contains(strings.ToLower(answer), strings.ToLower(j.User)) {
+		log.Infof("Not caching the answer of job %s, it names %s", j.ID, j.User)
+		return
+	}
+
+	speaker := p.persona(j.Persona)
+	current, _ := p.tracker.Get(j.ID)
+	if err := p.cache.Store(ctx, cacheScope(speaker, current.Metadata[languageMetadata]), cacheKey(speaker, j.Question), answer, videoLocalPath); err != nil {
+		log.Errorf("Error caching the answer of job %s: %v", j.ID, err)
+	}
+}
+
+// cacheScope keeps the clips of the persona in another language apart, they only answer questions in that language
+func cacheScope(speaker *persona.Persona, lang string) string {
+	if lang == "" || language.Base(lang) == language.Base(speaker.Language) {
+		return speaker.Name
+	}
+
+	return speaker.Name + "/" + language.Base(lang)
+}
+
+// cacheKey is the question without the trigger of the persona
+func cacheKey(speaker *persona.Persona, question string) string {
+	return strings.TrimSpace(strings.TrimPrefix(question, speaker.Trigger))
+}
+
+// generateAnswer to generate the whole answer, then its video, and publish it
+func (p *pipeline) generateAnswer(ctx context.Context, j job.Job, message string) (string, error) {
+	p.tracker.Update(j.ID, job.StatusGeneratingAnswer, nil)
+	answer, err := p.gpt.GenerateResponse(ctx, message)
+	if err != nil {
+		return "", fmt.Errorf("error generating response: %w", err)
+	}
+
+	log.Infof("Generated response for: %s", answer)
+
+	lang, _ := language.FromContext(ctx)
+	if answer, err = p.rules.check("answer", answer, lang, lang); err != nil {
+		return "", err
+	}
+
+	if err := p.moderate(ctx, "answer", answer); err != nil {
+		return "", err
+	}
+
+	videoLocalPath, err := p.speak(ctx, j, answer)
+	if err != nil {
+		return "", err
+	}
+
+	p.publish(j, videoLocalPath, answer)
+	return answer, nil
+}
+
+// moderate the text before it goes further in the pipeline, a flagged or unchecked text fails the job
+func (p *pipeline) moderate(ctx context.Context, kind string, text string) error {
+	if p.moderator == nil {
+		return nil
+	}
+
+	verdict, err := p.moderator.Moderate(ctx, text)
+	if err != nil {
+		return fmt.Errorf("error moderating %s: %w", kind, err)
+	}
+
+	if !verdict.Flagged {
+		log.Infof("Moderation passed %s %v", kind, verdict.Scores)
+		return nil
+	}
+
+	log.Warnf("Moderation flagged %s %v %v: %s", kind, verdict.Categories, verdict.Scores, text)
+	p.say(p.text(ctx, "refused"))
+	return fmt.Errorf("%s flagged by moderation: %v", kind, verdict.Categories)
+}
+
+// remember to add the answered question to the conversation of the viewer, runs in the background
+func (p *pipeline) remember(user string, turn conversation.Turn) {
+	ctx, cancel := context.WithTimeout(context.Background(), memoryTimeout)
+	defer cancel()
+	ctx = cost.WithJob(cost.NewContext(ctx, p.ledger), "", user)
+
+	if err := p.memory.Append(ctx, user, turn); err != nil {
+		log.Errorf("Error saving conversation of %s: %v", user, err)
+	}
+}
+
+// dialogue to script the conversation, generate a video per line with the speaking persona and stitch them
+func (p *pipeline) dialogue(ctx context.Context, j job.Job) error {
+	topic, err := p.rules.check("topic", j.Question, "", "")
+	if err != nil {
+		return err
+	}
+
+	// every persona of the dialogue plays the variant of its experiment, with its templates rendered on the topic
+	var (
+		personas = make([]*persona.Persona, 0, len(j.Personas))
+		variants []string
+	)
+	for _, name := range j.Personas {
+		speaker := p.persona(name)
+		if variant := p.experiments.Assign(speaker, j.ID, j.User); variant != "" {
+			variants = append(variants, speaker.Name+": "+variant)
+			speaker = speaker.WithVariant(variant)
+		}
+		personas = append(personas, speaker)
+	}
+	if len(variants) > 0 {
+		p.tracker.SetMetadata(j.ID, "variant", strings.Join(variants, ", "))
+	}
+
+	vars := p.vars(j.User)
+	vars.Topic = topic
+	ctx = gpt.NewVarsContext(ctx, vars)
+
+	if err := p.moderate(ctx, "topic", topic); err != nil {
+		return err
+	}
+
+	p.tracker.Update(j.ID, job.StatusGeneratingAnswer, nil)
+	lines, err := p.gpt.GenerateDialogue(ctx, topic, personas, dialogueTurns)
+	if err != nil {
+		return fmt.Errorf("error generating dialogue: %w", err)
+	}
+
+	var text string
+	for i, line := range lines {
+		if lines[i].Text, err = p.rules.check("dialogue line", line.Text, "", ""); err != nil {
+			return err
+		}
+		text += lines[i].Text + "\n"
+	}
+
+	if err := p.moderate(ctx, "dialogue", text); err != nil {
+		return err
+	}
+
+	var (
+		videos = make([]string, 0, len(lines))
+		script string
+	)
+
+	// the progress is told once for the whole dialogue, not for every line
+	p.tracker.Update(j.ID, job.StatusGeneratingVideo, nil)
+	p.say(p.text(ctx, "almost_ready"))
+
+	for i, line := range lines {
+		log.Infof("Dialogue line %d/%d %s: %s", i+1, len(lines), line.Persona, line.Text)
+
+		video, err := p.voice(persona.NewContext(ctx, p.persona(line.Persona)), j, line.Text)
+		if err != nil {
+			return fmt.Errorf("error generating line %d: %w", i+1, err)
+		}
+
+		videos = append(videos, video)
+		script += line.Persona + ": " + line.Text + "\n"
+	}
+
+	p.say(p.text(ctx, "anytime_now"))
+
+	videoLocalPath, err := p.stitcher.Stitch(ctx, videos)
+	if err != nil {
+		return err
+	}
+
+	if videoLocalPath, err = p.clips.claim(j.ID, videoLocalPath); err != nil {
+		return err
+	}
+
+	p.publish(j, videoLocalPath, script)
+	return nil
+}
+
+// speak to generate the audio and the lip sync video of the text with the persona of the context
+func (p *pipeline) speak(ctx context.Context, j job.Job, text string) (string, error) {
+	log.Infof("Generating audio for: %s", text)
+
+	p.tracker.Update(j.ID, job.StatusGeneratingAudio, nil)
+	fsKey, err := p.tts.GenerateAudio(ctx, text)
+	if err != nil {
+		return "", fmt.Errorf("error generating audio: %w", err)
+	}
+
+	p.say(p.text(ctx, "almost_ready"))
+
+	log.Infof("Generated audio: %s", fsKey)
+	log.Infof("Generating lip sync for: %s", text)
+
+	p.tracker.Update(j.ID, job.StatusGeneratingVideo, nil)
+	videoLocalPath, err := p.lipSync(ctx).GenerateLipSyncVideo(ctx, fsKey)
+	if err != nil {
+		return "", fmt.Errorf("error generating video: %w", err)
+	}
+
+	if videoLocalPath, err = p.clips.claim(j.ID, videoLocalPath); err != nil {
+		return "", err
+	}
+
+	p.say(p.text(ctx, "anytime_now"))
+
+	log.Infof("Generated video: %s", videoLocalPath)
+	return videoLocalPath, nil
+}
+
+// voice to generate the audio and the lip sync video of the text without reporting the progress
+func (p *pipeline) voice(ctx context.Context, j job.Job, text string) (string, error) {
+	fsKey, err := p.tts.GenerateAudio(ctx, text)
+	if err != nil {
+		return "", fmt.Errorf("error generating audio: %w", err)
+	}
+
+	videoLocalPath, err := p.lipSync(ctx).GenerateLipSyncVideo(ctx, fsKey)
+	if err != nil {
+		return "", fmt.Errorf("error generating video: %w", err)
+	}
+
+	if videoLocalPath, err = p.clips.claim(j.ID, videoLocalPath); err != nil {
+		return "", err
+	}
+
+	log.Infof("Generated video: %s", videoLocalPath)
+	return videoLocalPath, nil
+}
+
+// lipSync is the mixer of the clips, the audio over a still image when saving
+func (p *pipeline) lipSync(ctx context.Context) mixer.Mixer {
+	if _, ok := cost.SavingFromContext(ctx); ok && p.stills != nil {
+		return p.stills
+	}
+
+	return p.mixer
+}
+
+// publish to send the video of a job to the stream and the background stages
+func (p *pipeline) publish(j job.Job, videoLocalPath string, answer string) {
+	log.Infof("Sending video to queue: %s", videoLocalPath)
+
+	p.videoQueue.Enqueue(videoLocalPath)
+	p.tracker.Update(j.ID, job.StatusReady, nil)
+	p.release(j, videoLocalPath, answer)
+}
+
+// release the video of a job to the background stages, the replays, thumbnails and exports. The video has a path
+// of its own, the background stages read it after the next jobs
+func (p *pipeline) release(j job.Job, videoLocalPath string, answer string) {
+	messageTimer.Reset(autoPlayInterval)
+	questionTimer.Reset(autoQuestionGenerationInterval)
+
+	go generateThumbnails(p.thumbnails, videoLocalPath)
+	p.act(j)
+
+	// the cheaper answers would be replayed once the budget resets, they are not cached
+	if current, _ := p.tracker.Get(j.ID); p.cache != nil && j.Kind == job.KindQuestion && current.Metadata[savingMetadata] == "" {
+		go p.cacheAnswer(j, videoLocalPath, answer)
+	}
+
+	if p.exporter != nil {
+		go exportVertical(p.exporter, videoLocalPath, export.Metadata{
+			Question:  j.Question,
+			User:      j.User,
+			Answer:    answer,
+			CreatedAt: time.Now(),
+		})
+	}
+}
+
+// aired when the stream starts playing an item, the chat engagement of an experiment counts from its first clip
+func (p *pipeline) aired(item string) {
+	if jobID, ok := p.clips.job(item); ok {
+		p.experiments.Aired(jobID)
+	}
+}
+
+// persona of a job, falls back to the default persona when it was removed since the job was queued
+func (p *pipeline) persona(name string) *persona.Persona {
+	if found, ok := p.personas.Get(name); ok {
+		return found
+	}
+
+	log.Warnf("Persona %s not found, using %s", name, p.personas.Default().Name)
+	return p.personas.Default()
+}
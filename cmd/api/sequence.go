@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// sequencePrefix marks the items of the video queue played as a sequence of videos instead of a single video
+const sequencePrefix = "sequence:"
+
+// sequenceSize is a knob to control how many chunks of an answer can wait for the stream, more than an answer
+// budget can hold
+const sequenceSize = 64
+
+var (
+	// sequencesMutex for thread-safe access to sequences
+	sequencesMutex sync.Mutex
+
+	// sequences are the chunks of the streamed answers by video queue item, taken by the video queue when it plays them
+	sequences = make(map[string]chan string)
+)
+
+// newSequence registers the chunks of a job, the returned item goes to the video queue
+func newSequence(jobID string) (string, chan string) {
+	item := sequencePrefix + jobID
+	chunks := make(chan string, sequenceSize)
+
+	sequencesMutex.Lock()
+	sequences[item] = chunks
+	sequencesMutex.Unlock()
+
+	return item, chunks
+}
+
+// takeSequence the chunks of a video queue item, false when the item is a single video
+func takeSequence(item string) (<-chan string, bool) {
+	if !strings.HasPrefix(item, sequencePrefix) {
+		return nil, false
+	}
+
+	sequencesMutex.Lock()
+	defer sequencesMutex.Unlock()
+
+	chunks, ok := sequences[item]
+	delete(sequences, item)
+	return chunks, ok
+}
+
+// sendChunk never blocks, a chunk is dropped when the sequence stopped being played
+func sendChunk(chunks chan string, video string) {
+	select {
+	case chunks <- video:
+	default:
+		log.Warnf("Dropping chunk %s, the sequence is full", video)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/llumus/lulis/internal/job"
+	"github.com/llumus/lulis/internal/language"
+)
+
+// streamAnswer to speak the answer chunk by chunk while it is generated, the first sentence is voiced alone so
+// it airs as soon as possible, then every chunk takes the sentences generated while the previous one was voiced.
+// The chunks play as a sequence and the stitched answer goes to the replays, thumbnails and exports
+func (p *pipeline) streamAnswer(ctx context.Context, j job.Job, message string) (string, error) {
+	genCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		pending []string
+		done    bool
+		ready   = make(chan struct{}, 1)
+		result  = make(chan error, 1)
+	)
+
+	signal := func() {
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+	}
+
+	p.tracker.Update(j.ID, job.StatusGeneratingAnswer, nil)
+	go func() {
+		answer, err := p.gpt.StreamResponse(genCtx, message, func(sentence string) {
+			mu.Lock()
+			pending = append(pending, sentence)
+			mu.Unlock()
+			signal()
+		})
+
+		log.Infof("Streamed response for: %s", answer)
+
+		mu.Lock()
+		done = true
+		mu.Unlock()
+		signal()
+		result <- err
+	}()
+
+	var (
+		chunks chan string
+		videos []string
+		spoken []string
+	)
+
+	// the sequence ends with the last chunk, or with the chunks already aired when the job fails
+	defer func() {
+		if chunks != nil {
+			close(chunks)
+		}
+	}()
+
+	for {
+		mu.Lock()
+		text, finished := strings.Join(pending, " "), done
+		pending = nil
+		mu.Unlock()
+
+		if text == "" {
+			if finished {
+				break
+			}
+
+			select {
+			case <-ready:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			continue
+		}
+
+		video, err := p.speakChunk(ctx, j, text, chunks == nil)
+		if err != nil {
+			cancel()
+			return "", err
+		}
+
+		videos = append(videos, video)
+		spoken = append(spoken, text)
+
+		if chunks == nil {
+			var item string
+			item, chunks = newSequence(j.ID)
+			p.videoQueue.Enqueue(item)
+			p.tracker.Update(j.ID, job.StatusReady, nil)
+		}
+
+		log.Infof("Sending chunk %d to sequence: %s", len(videos), video)
+		sendChunk(chunks, video)
+	}
+
+	if err := <-result; err != nil && len(videos) == 0 {
+		return "", fmt.Errorf("error generating response: %w", err)
+	}
+
+	if len(videos) == 0 {
+		return "", fmt.Errorf("empty response")
+	}
+
+	// the answer is airing, its actions don't wait for the stitching
+	p.act(j)
+
+	answer := strings.Join(spoken, " ")
+	go p.releaseChunks(j, videos, answer)
+
+	return answer, nil
+}
+
+// speakChunk to check and voice a chunk of the answer, only the first chunk reports its progress
+func (p *pipeline) speakChunk(ctx context.Context, j job.Job, text string, first bool) (string, error) {
+	lang, _ := language.FromContext(ctx)
+	text, err := p.rules.check("answer", text, lang, lang)
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.moderate(ctx, "answer", text); err != nil {
+		return "", err
+	}
+
+	if first {
+		return p.speak(ctx, j, text)
+	}
+
+	log.Infof("Generating audio and lip sync for: %s", text)
+	return p.voice(ctx, j, text)
+}
+
+// releaseChunks to stitch the chunks of a streamed answer into a single video for the background stages
+func (p *pipeline) releaseChunks(j job.Job, videos []string, answer string) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	video := videos[0]
+	if len(videos) > 1 {
+		stitched, err := p.stitcher.Stitch(ctx, videos)
+		if err == nil {
+			stitched, err = p.clips.claim(j.ID, stitched)
+		}
+		if err != nil {
+			log.Errorf("Error stitching the chunks of job %s: %v", j.ID, err)
+			return
+		}
+		video = stitched
+	}
+
+	addPlayedVideo(video)
+	p.release(j, video, answer)
+}
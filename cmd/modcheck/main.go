@@ -0,0 +1,61 @@
+// modcheck checks messages against the moderation rules, one message per argument or per line of stdin
+//
+//	go run ./cmd/modcheck -rules assets/moderation_rules.json -lang pt "que pút4 pergunta"
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/llumus/lulis/internal/moderation/rules"
+)
+
+func main() {
+	rulesPath := flag.String("rules", "assets/moderation_rules.json", "moderation rules file")
+	language := flag.String("lang", "", "language of the messages, all the rules apply when empty")
+	flag.Parse()
+
+	r, err := rules.Load(*rulesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading rules: %v\n", err)
+		os.Exit(2)
+	}
+
+	messages := flag.Args()
+	if len(messages) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				messages = append(messages, line)
+			}
+		}
+	}
+
+	refused := false
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	for _, message := range messages {
+		verdict := r.Check(message, *language)
+		refused = refused || verdict.Refused()
+
+		var timeout string
+		if verdict.Timeout > 0 {
+			timeout = verdict.Timeout.String()
+		}
+
+		_ = encoder.Encode(struct {
+			Message string `json:"message"`
+			Timeout string `json:"timeout,omitempty"`
+			rules.Verdict
+		}{message, timeout, verdict})
+	}
+
+	if refused {
+		os.Exit(1)
+	}
+}
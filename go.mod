@@ -4,7 +4,6 @@ go 1.21.0
 
 require (
 	github.com/aws/aws-sdk-go v1.45.19
-	github.com/ayush6624/go-chatgpt v0.3.0
 	github.com/gempir/go-twitch-irc/v4 v4.0.0
 	github.com/google/uuid v1.3.1
 	github.com/sirupsen/logrus v1.9.3
@@ -0,0 +1,168 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// maxActions is how many actions a single answer can trigger
+const maxActions = 3
+
+// Action the personas can trigger on the stream, Parameters is the json schema of its arguments
+type Action struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+	// Run the action with the arguments of the model, validated against the whitelist but not the schema
+	Run func(ctx context.Context, args json.RawMessage) error
+}
+
+// Registry of the actions whitelisted by the operator, the others are never offered to the model
+type Registry struct {
+	allowed map[string]bool
+
+	mu      sync.RWMutex
+	actions map[string]Action
+}
+
+func NewRegistry(allowed []string) *Registry {
+	r := &Registry{
+		allowed: make(map[string]bool),
+		actions: make(map[string]Action),
+	}
+
+	for _, name := range allowed {
+		if name = strings.TrimSpace(name); name != "" {
+			r.allowed[name] = true
+		}
+	}
+
+	return r
+}
+
+// Register the action if it is whitelisted
+func (r *Registry) Register(a Action) {
+	if !r.allowed[a.Name] {
+		log.Debugf("Action %s not whitelisted, not registered", a.Name)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.actions[a.Name] = a
+	log.Infof("Action %s registered", a.Name)
+}
+
+// Actions registered, by name
+func (r *Registry) Actions() []Action {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	actions := make([]Action, 0, len(r.actions))
+	for _, a := range r.actions {
+		actions = append(actions, a)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Name < actions[j].Name })
+
+	return actions
+}
+
+// Plan collects the actions requested while an answer is generated, they run once the answer airs
+func (r *Registry) Plan() *Plan {
+	return &Plan{registry: r}
+}
+
+type call struct {
+	action Action
+	args   json.RawMessage
+}
+
+// Plan of the actions of an answer
+type Plan struct {
+	registry *Registry
+
+	mu    sync.Mutex
+	calls []call
+}
+
+// Actions the model can request
+func (p *Plan) Actions() []Action {
+	return p.registry.Actions()
+}
+
+// Request the action with the json arguments of the model, the result is told back to the model
+func (p *Plan) Request(name string, arguments string) string {
+	p.registry.mu.RLock()
+	a, ok := p.registry.actions[name]
+	p.registry.mu.RUnlock()
+	if !ok {
+		log.Warnf("Model requested the unknown action %s", name)
+		return fmt.Sprintf("error: there is no action %s", name)
+	}
+
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	if !json.Valid([]byte(arguments)) {
+		log.Warnf("Model requested the action %s with broken arguments: %s", name, arguments)
+		return "error: the arguments are not valid json"
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.calls) >= maxActions {
+		return fmt.Sprintf("error: at most %d actions per answer", maxActions)
+	}
+
+	p.calls = append(p.calls, call{action: a, args: json.RawMessage(arguments)})
+	log.Infof("Action %s planned with %s", name, arguments)
+	return "ok: " + name + " will happen while you speak, answer the viewer now"
+}
+
+// Names of the planned actions, in order
+func (p *Plan) Names() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := make([]string, 0, len(p.calls))
+	for _, c := range p.calls {
+		names = append(names, c.action.Name)
+	}
+
+	return names
+}
+
+// Run the planned actions in order, a failing action doesn't stop the next ones
+func (p *Plan) Run(ctx context.Context) {
+	p.mu.Lock()
+	calls := p.calls
+	p.mu.Unlock()
+
+	for _, c := range calls {
+		if err := c.action.Run(ctx, c.args); err != nil {
+			log.Errorf("Error running the action %s with %s: %v", c.action.Name, c.args, err)
+		}
+	}
+}
+
+type contextKey struct{}
+
+// NewContext carries the plan of the answer to the assistant
+func NewContext(ctx context.Context, p *Plan) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+func FromContext(ctx context.Context) (*Plan, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Plan)
+	return p, ok && p != nil
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/llumus/lulis/internal/text"
+)
+
+// Entry is a generated answer clip and the question it answers
+type Entry struct {
+	ID         string    `json:"id"`
+	Persona    string    `json:"persona"`
+	Question   string    `json:"question"`
+	Normalized string    `json:"normalized"`
+	Embedding  []float64 `json:"embedding,omitempty"`
+	Answer     string    `json:"answer"`
+	Video      string    `json:"video"`
+	CreatedAt  time.Time `json:"created_at"`
+	Hits       int       `json:"hits"`
+	LastHit    time.Time `json:"last_hit,omitempty"`
+}
+
+// Match is a cached answer to a question close enough to the one looked up, Similarity goes from 0 to 1
+type Match struct {
+	Entry
+	Similarity float64
+}
+
+// Cache maps the questions to the clips already generated for them, per persona
+type Cache interface {
+	// Lookup the closest cached answer of the persona over the similarity threshold, false when there is none
+	Lookup(ctx context.Context, persona string, question string, threshold float64) (Match, bool, error)
+	// Store a copy of the clip answering the question
+	Store(ctx context.Context, persona string, question string, answer string, videoPath string) error
+}
+
+// Normalize the question to compare it, lower case words without diacritics nor punctuation
+func Normalize(question string) string {
+	return strings.Join(strings.FieldsFunc(text.Fold(question), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// Jaccard similarity of the words of two normalized questions, from 0 to 1
+func Jaccard(a, b string) float64 {
+	wordsA, wordsB := words(a), words(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return 0
+	}
+
+	var common int
+	for word := range wordsA {
+		if wordsB[word] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(wordsA)+len(wordsB)-common)
+}
+
+func words(normalized string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(normalized) {
+		set[word] = true
+	}
+
+	return set
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		question string
+		want     string
+	}{
+		{"Lula, qual é a sua comida favorita?", "lula qual e a sua comida favorita"},
+		{"  What's   UP?! ", "what s up"},
+		{"Top 10 games", "top 10 games"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.question, func(t *testing.T) {
+			if got := Normalize(tt.question); got != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"same words", "what is your name", "your name is what", 1},
+		{"half the words", "what is your name", "what is your age", 0.6},
+		{"repeated words", "very very good", "very good", 1},
+		{"nothing in common", "hello there", "good bye", 0},
+		{"empty", "", "hello", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Jaccard(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Jaccard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/llumus/lulis/internal/cache"
+	"github.com/llumus/lulis/internal/embedding"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+const (
+	indexName  = "answer_cache.json"
+	clipPrefix = "cache_"
+)
+
+// Cache keeps a copy of the clips next to the stream playlist, so they survive the rotation of the tmp files,
+// and a json index of their questions. The questions are compared with their embeddings when there is an
+// embedder, with their normalized words otherwise
+type Cache struct {
+	dir        string
+	maxEntries int
+	maxAge     time.Duration
+	embedder   embedding.Embedder
+
+	mu      sync.Mutex
+	entries []cache.Entry
+}
+
+// NewCache dir must be the folder of the stream playlist, the embedder is optional
+func NewCache(dir string, maxEntries int, maxAge time.Duration, embedder embedding.Embedder) (*Cache, error) {
+	c := &Cache{
+		dir:        dir,
+		maxEntries: maxEntries,
+		maxAge:     maxAge,
+		embedder:   embedder,
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, indexName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(data, &c.entries); err != nil {
+			return nil, err
+		}
+	}
+
+	// the clips may have been cleaned with the tmp folder
+	entries := c.entries[:0]
+	for _, entry := range c.entries {
+		if _, err := os.Stat(filepath.Join(dir, entry.Video)); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	c.entries = entries
+
+	log.Infof("Loaded %d cached answers", len(c.entries))
+	return c, nil
+}
+
+func (c *Cache) Lookup(ctx context.Context, persona string, question string, threshold float64) (cache.Match, bool, error) {
+	normalized := cache.Normalize(question)
+
+	var vector []float64
+	if c.embedder != nil {
+		var err error
+		if vector, err = c.embedder.Embed(ctx, normalized); err != nil {
+			return cache.Match{}, false, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var (
+		best  cache.Match
+		index = -1
+	)
+
+	for i, entry := range c.entries {
+		if entry.Persona != persona || c.expired(entry) {
+			continue
+		}
+
+		similarity := 1.0
+		if entry.Normalized != normalized {
+			if vector != nil && entry.Embedding != nil {
+				similarity = embedding.Cosine(vector, entry.Embedding)
+			} else {
+				similarity = cache.Jaccard(normalized, entry.Normalized)
+			}
+		}
+
+		if similarity >= threshold && similarity > best.Similarity {
+			best = cache.Match{Entry: entry, Similarity: similarity}
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return cache.Match{}, false, nil
+	}
+
+	c.entries[index].Hits++
+	c.entries[index].LastHit = time.Now()
+	best.Entry = c.entries[index]
+	best.Video = filepath.Join(c.dir, best.Video)
+
+	if err := c.save(); err != nil {
+		log.Errorf("Error saving answer cache: %v", err)
+	}
+
+	return best, true, nil
+}
+
+func (c *Cache) Store(ctx context.Context, persona string, question string, answer string, videoPath string) error {
+	entry := cache.Entry{
+		ID:         uuid.NewString(),
+		Persona:    persona,
+		Question:   question,
+		Normalized: cache.Normalize(question),
+		Answer:     answer,
+		CreatedAt:  time.Now(),
+	}
+
+	if c.embedder != nil {
+		vector, err := c.embedder.Embed(ctx, entry.Normalized)
+		if err != nil {
+			return err
+		}
+		entry.Embedding = vector
+	}
+
+	entry.Video = clipPrefix + entry.ID + filepath.Ext(videoPath)
+	if err := copyFile(videoPath, filepath.Join(c.dir, entry.Video)); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = append(c.entries, entry)
+	c.evict()
+
+	return c.save()
+}
+
+func (c *Cache) expired(entry cache.Entry) bool {
+	return c.maxAge > 0 && time.Since(entry.CreatedAt) > c.maxAge
+}
+
+// evict the expired entries and the least recently used ones over the max entries, with their clips
+func (c *Cache) evict() {
+	sort.SliceStable(c.entries, func(i, j int) bool {
+		return lastUsed(c.entries[i]).After(lastUsed(c.entries[j]))
+	})
+
+	kept := c.entries[:0]
+	for _, entry := range c.entries {
+		if c.expired(entry) || (c.maxEntries > 0 && len(kept) >= c.maxEntries) {
+			_ = os.Remove(filepath.Join(c.dir, entry.Video))
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	c.entries = kept
+}
+
+func lastUsed(entry cache.Entry) time.Time {
+	if entry.LastHit.After(entry.CreatedAt) {
+		return entry.LastHit
+	}
+
+	return entry.CreatedAt
+}
+
+func (c *Cache) save() error {
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(c.dir, indexName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func copyFile(src, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	_, err = io.Copy(destination, source)
+	return err
+}
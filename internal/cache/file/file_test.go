@@ -0,0 +1,103 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// clip writes a fake clip to store
+func clip(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("error writing clip: %v", err)
+	}
+
+	return path
+}
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewCache(t.TempDir(), 0, 0, nil)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+
+	if err := c.Store(ctx, "lula", "What is your favorite food?", "Feijoada!", clip(t, "food")); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := c.Store(ctx, "lula", "Where do you live?", "Brasilia.", clip(t, "home")); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		persona   string
+		question  string
+		threshold float64
+		answer    string
+	}{
+		{"same question", "lula", "what is your FAVORITE food", 0.9, "Feijoada!"},
+		{"close question", "lula", "what is your favorite drink?", 0.6, "Feijoada!"},
+		{"under the threshold", "lula", "what is your favorite drink?", 0.8, ""},
+		{"other persona", "bolsonaro", "What is your favorite food?", 0.5, ""},
+		{"other language scope", "lula/es", "Where do you live?", 0.5, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, ok, err := c.Lookup(ctx, tt.persona, tt.question, tt.threshold)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+
+			if ok != (tt.answer != "") || match.Answer != tt.answer {
+				t.Fatalf("Lookup() = %q %v, want %q", match.Answer, ok, tt.answer)
+			}
+			if !ok {
+				return
+			}
+
+			if _, err := os.Stat(match.Video); err != nil {
+				t.Errorf("clip %s of the match: %v", match.Video, err)
+			}
+		})
+	}
+}
+
+func TestEvict(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	c, err := NewCache(dir, 2, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+
+	for _, question := range []string{"first question", "second question", "third question"} {
+		if err := c.Store(ctx, "lula", question, question, clip(t, question)); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+		// the entries are ordered by their last use
+		time.Sleep(time.Millisecond)
+	}
+
+	reloaded, err := NewCache(dir, 2, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+
+	for question, want := range map[string]bool{"first question": false, "second question": true, "third question": true} {
+		if _, ok, _ := reloaded.Lookup(ctx, "lula", question, 1); ok != want {
+			t.Errorf("Lookup(%q) = %v, want %v", question, ok, want)
+		}
+	}
+
+	clips, _ := filepath.Glob(filepath.Join(dir, clipPrefix+"*"))
+	if len(clips) != 2 {
+		t.Errorf("clips = %v, want the 2 kept", clips)
+	}
+}
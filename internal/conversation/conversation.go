@@ -0,0 +1,60 @@
+package conversation
+
+import (
+	"context"
+	"time"
+)
+
+// Turn is a question of a viewer and the answer of a persona
+type Turn struct {
+	Persona  string    `json:"persona"`
+	Question string    `json:"question"`
+	Answer   string    `json:"answer"`
+	Time     time.Time `json:"time"`
+}
+
+// Conversation is what a persona remembers of a viewer, the latest turns and a summary of the older ones
+type Conversation struct {
+	User    string `json:"user"`
+	Summary string `json:"summary,omitempty"`
+	Turns   []Turn `json:"turns"`
+}
+
+func (c Conversation) Empty() bool {
+	return c.Summary == "" && len(c.Turns) == 0
+}
+
+// With only the turns of the persona, the summary of the older conversations is shared by all the personas
+func (c Conversation) With(persona string) Conversation {
+	turns := make([]Turn, 0, len(c.Turns))
+	for _, turn := range c.Turns {
+		if turn.Persona == persona {
+			turns = append(turns, turn)
+		}
+	}
+
+	c.Turns = turns
+	return c
+}
+
+type Memory interface {
+	Get(ctx context.Context, user string) (Conversation, error)
+	Append(ctx context.Context, user string, turn Turn) error
+}
+
+// Summarizer folds the turns leaving the window into the rolling summary
+type Summarizer interface {
+	SummarizeConversation(ctx context.Context, summary string, turns []Turn) (string, error)
+}
+
+type contextKey struct{}
+
+// NewContext carries the conversation of the viewer asking to the gpt stage
+func NewContext(ctx context.Context, c Conversation) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+func FromContext(ctx context.Context) (Conversation, bool) {
+	c, ok := ctx.Value(contextKey{}).(Conversation)
+	return c, ok
+}
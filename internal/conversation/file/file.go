@@ -0,0 +1,140 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/llumus/lulis/internal/conversation"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// Memory keeps a json file per viewer, when the window is full the oldest turns are summarized. The summary is made
+// without the lock, the other viewers and the next question of the viewer don't wait for it
+type Memory struct {
+	dir        string
+	window     int
+	summarizer conversation.Summarizer
+
+	mu sync.Mutex
+	// summarizing are the viewers with a summary being made, one at a time per viewer
+	summarizing map[string]bool
+}
+
+func NewMemory(dir string, window int, summarizer conversation.Summarizer) (*Memory, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Memory{
+		dir:         dir,
+		window:      window,
+		summarizer:  summarizer,
+		summarizing: make(map[string]bool),
+	}, nil
+}
+
+func (m *Memory) Get(_ context.Context, user string) (conversation.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.read(user)
+}
+
+func (m *Memory) Append(ctx context.Context, user string, turn conversation.Turn) error {
+	m.mu.Lock()
+	c, err := m.read(user)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	c.Turns = append(c.Turns, turn)
+	if err := m.write(user, c); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+
+	if len(c.Turns) <= m.window || m.summarizing[user] {
+		m.mu.Unlock()
+		return nil
+	}
+
+	m.summarizing[user] = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.summarizing, user)
+		m.mu.Unlock()
+	}()
+
+	overflow := c.Turns[:len(c.Turns)-m.window]
+	summary, err := m.summarizer.SummarizeConversation(ctx, c.Summary, overflow)
+	if err != nil {
+		// keep the turns, the summary is tried again on the next append
+		log.Errorf("Error summarizing conversation of %s: %v", user, err)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the turns appended while summarizing are kept, only the summarized ones are folded
+	latest, err := m.read(user)
+	if err != nil {
+		return err
+	}
+
+	latest.Summary = summary
+	latest.Turns = latest.Turns[min(len(overflow), len(latest.Turns)):]
+	return m.write(user, latest)
+}
+
+func (m *Memory) write(user string, c conversation.Conversation) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := m.path(user) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.path(user))
+}
+
+func (m *Memory) read(user string) (conversation.Conversation, error) {
+	data, err := os.ReadFile(m.path(user))
+	if os.IsNotExist(err) {
+		return conversation.Conversation{User: user}, nil
+	}
+	if err != nil {
+		return conversation.Conversation{}, err
+	}
+
+	var c conversation.Conversation
+	if err := json.Unmarshal(data, &c); err != nil {
+		return conversation.Conversation{}, err
+	}
+
+	return c, nil
+}
+
+// path of the viewer file, twitch names are only letters, numbers and underscores but better safe than sorry
+func (m *Memory) path(user string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(user))
+
+	return filepath.Join(m.dir, name+".json")
+}
@@ -0,0 +1,118 @@
+package cost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Unit of the usage billed by a provider
+type Unit string
+
+const (
+	UnitPromptTokens     Unit = "prompt_tokens"
+	UnitCompletionTokens Unit = "completion_tokens"
+	UnitCharacters       Unit = "characters"
+	UnitSeconds          Unit = "seconds"
+)
+
+// Prices in dollars per unit, by model or by provider for the providers billing every model the same
+type Prices map[string]map[Unit]float64
+
+// DefaultPrices of the models used by default, the local models are free
+var DefaultPrices = Prices{
+	"gpt-4":                  {UnitPromptTokens: 0.00003, UnitCompletionTokens: 0.00006},
+	"gpt-4o":                 {UnitPromptTokens: 0.0000025, UnitCompletionTokens: 0.00001},
+	"gpt-4o-mini":            {UnitPromptTokens: 0.00000015, UnitCompletionTokens: 0.0000006},
+	"gpt-3.5-turbo":          {UnitPromptTokens: 0.0000005, UnitCompletionTokens: 0.0000015},
+	"text-embedding-3-small": {UnitPromptTokens: 0.00000002},
+	"eleven_multilingual_v2": {UnitCharacters: 0.0003},
+	// Replicate bills the seconds of the hardware running the prediction, an Nvidia T4
+	"replicate": {UnitSeconds: 0.000225},
+}
+
+// LoadPrices reads a json object of the prices on top of the default ones, e.g. {"gpt-4": {"prompt_tokens": 0.00003}}
+func LoadPrices(path string) (Prices, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded Prices
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("error parsing prices %s: %w", path, err)
+	}
+
+	prices := make(Prices, len(DefaultPrices)+len(loaded))
+	for model, units := range DefaultPrices {
+		prices[model] = units
+	}
+	for model, units := range loaded {
+		prices[model] = units
+	}
+
+	return prices, nil
+}
+
+// Price of a unit of the model, the longest model name prefixing it wins so "gpt-4-0613" costs as "gpt-4", then the
+// price of the provider. Unknown models are free
+func (p Prices) Price(provider, model string, unit Unit) float64 {
+	var (
+		price   float64
+		longest = -1
+	)
+
+	for name, units := range p {
+		if len(name) > longest && strings.HasPrefix(model, name) {
+			if unitPrice, ok := units[unit]; ok {
+				price, longest = unitPrice, len(name)
+			}
+		}
+	}
+
+	if longest < 0 {
+		price = p[provider][unit]
+	}
+
+	return price
+}
+
+type ledgerKey struct{}
+
+type scopeKey struct{}
+
+// scope is what the usage is spent on
+type scope struct {
+	job  string
+	user string
+}
+
+// NewContext carries the ledger to the providers
+func NewContext(ctx context.Context, l *Ledger) context.Context {
+	return context.WithValue(ctx, ledgerKey{}, l)
+}
+
+// WithJob to account the usage to the job and the viewer who asked
+func WithJob(ctx context.Context, job, user string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope{job: job, user: user})
+}
+
+// Record the usage of a provider in the ledger of the context, if any
+func Record(ctx context.Context, provider, model string, unit Unit, quantity float64) {
+	l, ok := ctx.Value(ledgerKey{}).(*Ledger)
+	if !ok || l == nil || quantity <= 0 {
+		return
+	}
+
+	s, _ := ctx.Value(scopeKey{}).(scope)
+	l.Add(Entry{
+		Job:      s.job,
+		User:     s.user,
+		Provider: provider,
+		Model:    model,
+		Unit:     unit,
+		Quantity: quantity,
+	})
+}
@@ -0,0 +1,120 @@
+package cost
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Level of the spending against the limits of the budget
+type Level int
+
+const (
+	LevelNormal Level = iota
+	// LevelSoft saves on every call, see Saving
+	LevelSoft
+	// LevelHard takes no new questions until the budget resets
+	LevelHard
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelSoft:
+		return "soft"
+	case LevelHard:
+		return "hard"
+	default:
+		return "normal"
+	}
+}
+
+// Limits of the spending in dollars per day, 0 for no limit
+type Limits struct {
+	Soft float64
+	Hard float64
+	// Reset is the time of the day the budget starts over, midnight by default
+	Reset time.Duration
+}
+
+// Guard follows the spending of the day in the ledger against the limits
+type Guard struct {
+	ledger   *Ledger
+	limits   Limits
+	onChange func(from, to Level)
+
+	mu    sync.Mutex
+	level Level
+}
+
+// NewGuard onChange is called every time the level changes, e.g. to tell the chat
+func NewGuard(ledger *Ledger, limits Limits, onChange func(from, to Level)) *Guard {
+	return &Guard{
+		ledger:   ledger,
+		limits:   limits,
+		onChange: onChange,
+	}
+}
+
+// Level of the spending since the last reset
+func (g *Guard) Level() Level {
+	spent := g.ledger.SpentSince(g.start(time.Now()))
+
+	level := LevelNormal
+	switch {
+	case g.limits.Hard > 0 && spent >= g.limits.Hard:
+		level = LevelHard
+	case g.limits.Soft > 0 && spent >= g.limits.Soft:
+		level = LevelSoft
+	}
+
+	g.mu.Lock()
+	previous := g.level
+	g.level = level
+	g.mu.Unlock()
+
+	if level != previous {
+		log.Warnf("Budget level %s, $%.2f spent since %s", level, spent, g.start(time.Now()).Format(time.Kitchen))
+		if g.onChange != nil {
+			g.onChange(previous, level)
+		}
+	}
+
+	return level
+}
+
+// NextReset of the budget
+func (g *Guard) NextReset() time.Time {
+	return g.start(time.Now()).AddDate(0, 0, 1)
+}
+
+// start of the budget day of now
+func (g *Guard) start(now time.Time) time.Time {
+	year, month, day := now.Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, now.Location()).Add(g.limits.Reset)
+	if start.After(now) {
+		start = start.AddDate(0, 0, -1)
+	}
+
+	return start
+}
+
+// Saving is how the calls are cut down once the soft limit is reached: shorter answers with a cheaper model, cached
+// clips replayed more easily and the lip sync replaced by the audio over a still image
+type Saving struct {
+	// AnswerRatio scales down the spoken duration budget of the answers
+	AnswerRatio float64
+	// CacheRatio scales down the similarity a question needs to replay a cached clip
+	CacheRatio float64
+}
+
+type savingKey struct{}
+
+// WithSaving to make the calls of the context cheaper
+func WithSaving(ctx context.Context, s Saving) context.Context {
+	return context.WithValue(ctx, savingKey{}, s)
+}
+
+func SavingFromContext(ctx context.Context) (Saving, bool) {
+	s, ok := ctx.Value(savingKey{}).(Saving)
+	return s, ok
+}
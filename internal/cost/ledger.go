@@ -0,0 +1,208 @@
+package cost
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// dayLayout is the format of the days of the summaries, in the local time of the server
+const dayLayout = "2006-01-02"
+
+// Entry is a provider call with its estimated cost in dollars
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Job      string    `json:"job,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Provider string    `json:"provider"`
+	Model    string    `json:"model,omitempty"`
+	Unit     Unit      `json:"unit"`
+	Quantity float64   `json:"quantity"`
+	Cost     float64   `json:"cost"`
+}
+
+// Totals of a provider model unit
+type Totals struct {
+	Provider string  `json:"provider"`
+	Model    string  `json:"model,omitempty"`
+	Unit     Unit    `json:"unit"`
+	Quantity float64 `json:"quantity"`
+	Cost     float64 `json:"cost"`
+}
+
+// Summary of the spending of a day
+type Summary struct {
+	Day       string             `json:"day"`
+	Cost      float64            `json:"cost"`
+	Providers []Totals           `json:"providers"`
+	Users     map[string]float64 `json:"users"`
+	Jobs      map[string]float64 `json:"jobs"`
+}
+
+// Ledger keeps the entries in memory and appends them to a json lines file, to survive the restarts
+type Ledger struct {
+	mu      sync.Mutex
+	path    string
+	prices  Prices
+	entries []Entry
+}
+
+func NewLedger(path string, prices Prices) (*Ledger, error) {
+	l := &Ledger{path: path, prices: prices}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Warnf("Skipping a broken line of the ledger %s: %v", path, err)
+			continue
+		}
+		l.entries = append(l.entries, e)
+	}
+
+	return l, scanner.Err()
+}
+
+// Add the entry priced, it is saved right away
+func (l *Ledger) Add(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Cost = e.Quantity * l.prices.Price(e.Provider, e.Model, e.Unit)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, e)
+	if err := l.save(e); err != nil {
+		log.Errorf("Error saving the ledger entry of %s: %v", e.Provider, err)
+	}
+}
+
+// save appends the entry to the file, must be called with the lock held
+func (l *Ledger) save(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// SpentSince in dollars
+func (l *Ledger) SpentSince(since time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var spent float64
+	for _, e := range l.entries {
+		if !e.Time.Before(since) {
+			spent += e.Cost
+		}
+	}
+
+	return spent
+}
+
+// Day summary of the spending on the day of t, per provider, viewer and job
+func (l *Ledger) Day(t time.Time) Summary {
+	summary := Summary{
+		Day:   t.Local().Format(dayLayout),
+		Users: make(map[string]float64),
+		Jobs:  make(map[string]float64),
+	}
+
+	l.mu.Lock()
+	var entries []Entry
+	for _, e := range l.entries {
+		if e.Time.Local().Format(dayLayout) == summary.Day {
+			entries = append(entries, e)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, e := range entries {
+		summary.Cost += e.Cost
+		if e.User != "" {
+			summary.Users[e.User] += e.Cost
+		}
+		if e.Job != "" {
+			summary.Jobs[e.Job] += e.Cost
+		}
+	}
+
+	summary.Providers = totals(entries)
+	return summary
+}
+
+// Totals of every provider model unit since the ledger started
+func (l *Ledger) Totals() []Totals {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return totals(l.entries)
+}
+
+func totals(entries []Entry) []Totals {
+	type key struct {
+		provider, model string
+		unit            Unit
+	}
+
+	byKey := make(map[key]*Totals)
+	for _, e := range entries {
+		k := key{provider: e.Provider, model: e.Model, unit: e.Unit}
+		t, ok := byKey[k]
+		if !ok {
+			t = &Totals{Provider: e.Provider, Model: e.Model, Unit: e.Unit}
+			byKey[k] = t
+		}
+
+		t.Quantity += e.Quantity
+		t.Cost += e.Cost
+	}
+
+	list := make([]Totals, 0, len(byKey))
+	for _, t := range byKey {
+		list = append(list, *t)
+	}
+
+	sort.Slice(list, func(a, b int) bool {
+		if list[a].Provider != list[b].Provider {
+			return list[a].Provider < list[b].Provider
+		}
+		if list[a].Model != list[b].Model {
+			return list[a].Model < list[b].Model
+		}
+		return list[a].Unit < list[b].Unit
+	})
+
+	return list
+}
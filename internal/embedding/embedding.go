@@ -0,0 +1,31 @@
+package embedding
+
+import (
+	"context"
+	"math"
+)
+
+// Embedder turns a text into a vector, texts with close meanings have close vectors
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// Cosine similarity of two vectors, from -1 to 1, 0 when their sizes differ
+func Cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
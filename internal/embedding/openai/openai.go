@@ -0,0 +1,100 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/llumus/lulis/internal/cost"
+)
+
+const defaultBaseUrl = "https://api.openai.com/v1"
+
+type Payload struct {
+	Input string `json:"input"`
+	Model string `json:"model"`
+}
+
+type Data struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+type Usage struct {
+	PromptTokens int `json:"prompt_tokens"`
+}
+
+type Response struct {
+	Data  []Data `json:"data"`
+	Usage Usage  `json:"usage"`
+}
+
+// Embedder uses the /embeddings endpoint of OpenAI or of any compatible server, e.g. Ollama
+type Embedder struct {
+	baseUrl string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewEmbedder baseUrl defaults to the OpenAI api
+func NewEmbedder(baseUrl string, apiKey string, model string, client *http.Client) *Embedder {
+	if baseUrl == "" {
+		baseUrl = defaultBaseUrl
+	}
+
+	return &Embedder{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  client,
+	}
+}
+
+func (e *Embedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	jsonData, err := json.Marshal(Payload{Input: text, Model: e.model})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseUrl+"/embeddings", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var response Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("no embedding in the response")
+	}
+
+	cost.Record(ctx, "embedding", e.model, cost.UnitPromptTokens, float64(response.Usage.PromptTokens))
+
+	return response.Data[0].Embedding, nil
+}
@@ -0,0 +1,271 @@
+package experiment
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/persona"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// followUpWindow is how long after an answer the viewer asking again counts as a follow up of its variant
+const followUpWindow = 30 * time.Minute
+
+// engagementWindow is how long after an answer airs the chat messages count for its variant
+const engagementWindow = 10 * time.Minute
+
+// pendingAge is how long an assigned job can wait to air before it is forgotten, e.g. when it failed
+const pendingAge = 24 * time.Hour
+
+const (
+	EventAssign   = "assign"
+	EventFollowUp = "follow_up"
+	EventMessage  = "message"
+)
+
+// Event of an experiment, the log of the events is replayed on start
+type Event struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"event"`
+	Persona string    `json:"persona"`
+	Variant string    `json:"variant"`
+	Job     string    `json:"job,omitempty"`
+	User    string    `json:"user,omitempty"`
+}
+
+// Stats of the chat engagement of a variant
+type Stats struct {
+	Persona     string `json:"persona"`
+	Variant     string `json:"variant"`
+	Assignments int    `json:"assignments"`
+	// FollowUps are the viewers asking again soon after their answer
+	FollowUps int `json:"follow_ups"`
+	// Messages in the chat right after the answers of the variant aired
+	Messages int `json:"messages"`
+	// Engagement is the follow ups and messages per assignment
+	Engagement float64 `json:"engagement"`
+}
+
+type key struct {
+	persona, variant string
+}
+
+// Recorder assigns the variants of the persona prompts and follows the chat engagement of each variant
+type Recorder struct {
+	mu    sync.Mutex
+	path  string
+	stats map[key]*Stats
+	// viewers have the latest assignment of each viewer, for the follow ups
+	viewers map[string]Event
+	// pending are the assignments of the jobs not aired yet, one per persona of a dialogue
+	pending map[string][]Event
+	// onAir are the assignments of the latest aired answer
+	onAir   []Event
+	airedAt time.Time
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	r := &Recorder{
+		path:    path,
+		stats:   make(map[key]*Stats),
+		viewers: make(map[string]Event),
+		pending: make(map[string][]Event),
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Warnf("Skipping a broken line of the experiments %s: %v", path, err)
+			continue
+		}
+		r.apply(e)
+	}
+
+	r.prune(time.Now())
+	return r, scanner.Err()
+}
+
+// Assign a variant of the persona to the job, the same one to a viewer every time, empty when the persona has no
+// variants
+func (r *Recorder) Assign(p *persona.Persona, jobID, user string) string {
+	if len(p.Variants) == 0 {
+		return ""
+	}
+
+	var total float64
+	for _, v := range p.Variants {
+		total += weight(v)
+	}
+
+	pick := rand.Float64() * total
+	if user != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(p.Name + "/" + user))
+		pick = float64(h.Sum32()) / (1 << 32) * total
+	}
+
+	variant := p.Variants[len(p.Variants)-1].Name
+	for _, v := range p.Variants {
+		if pick < weight(v) {
+			variant = v.Name
+			break
+		}
+		pick -= weight(v)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	// the other personas of a dialogue are assigned to the same job, they are not a follow up
+	if previous, ok := r.viewers[user]; ok && user != "" && previous.Job != jobID && now.Sub(previous.Time) <= followUpWindow {
+		r.record(Event{Time: now, Kind: EventFollowUp, Persona: previous.Persona, Variant: previous.Variant, User: user})
+	}
+
+	log.Infof("Variant %s of %s assigned to job %s of %q", variant, p.Name, jobID, user)
+	r.record(Event{Time: now, Kind: EventAssign, Persona: p.Name, Variant: variant, Job: jobID, User: user})
+	return variant
+}
+
+func weight(v persona.Variant) float64 {
+	if v.Weight <= 0 {
+		return 1
+	}
+
+	return v.Weight
+}
+
+// Aired when the answer of the job goes to the stream, the next chat messages count for its variant
+func (r *Recorder) Aired(jobID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events, ok := r.pending[jobID]
+	if !ok {
+		return
+	}
+
+	delete(r.pending, jobID)
+	r.onAir, r.airedAt = events, time.Now()
+}
+
+// Message in the chat, counted for the variants of the answer that just aired
+func (r *Recorder) Message(user string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.airedAt) > engagementWindow {
+		return
+	}
+
+	for _, e := range r.onAir {
+		r.record(Event{Time: time.Now(), Kind: EventMessage, Persona: e.Persona, Variant: e.Variant, User: user})
+	}
+}
+
+// Stats of every variant assigned, by persona and variant
+func (r *Recorder) Stats() []Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]Stats, 0, len(r.stats))
+	for _, s := range r.stats {
+		c := *s
+		if c.Assignments > 0 {
+			c.Engagement = float64(c.FollowUps+c.Messages) / float64(c.Assignments)
+		}
+		stats = append(stats, c)
+	}
+
+	sort.Slice(stats, func(a, b int) bool {
+		if stats[a].Persona != stats[b].Persona {
+			return stats[a].Persona < stats[b].Persona
+		}
+		return stats[a].Variant < stats[b].Variant
+	})
+
+	return stats
+}
+
+// prune the jobs that never aired and the viewers past their follow up window, must be called with the lock held
+func (r *Recorder) prune(now time.Time) {
+	for id, events := range r.pending {
+		if now.Sub(events[0].Time) > pendingAge {
+			delete(r.pending, id)
+		}
+	}
+
+	for user, e := range r.viewers {
+		if now.Sub(e.Time) > followUpWindow {
+			delete(r.viewers, user)
+		}
+	}
+}
+
+// record the event and append it to the log, must be called with the lock held
+func (r *Recorder) record(e Event) {
+	r.apply(e)
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("Error encoding the experiment event: %v", err)
+		return
+	}
+
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Errorf("Error saving the experiment event: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Errorf("Error saving the experiment event: %v", err)
+	}
+}
+
+// apply the event to the stats, must be called with the lock held
+func (r *Recorder) apply(e Event) {
+	k := key{persona: e.Persona, variant: e.Variant}
+	s, ok := r.stats[k]
+	if !ok {
+		s = &Stats{Persona: e.Persona, Variant: e.Variant}
+		r.stats[k] = s
+	}
+
+	switch e.Kind {
+	case EventAssign:
+		s.Assignments++
+		if e.User != "" {
+			r.viewers[e.User] = e
+		}
+		if e.Job != "" {
+			r.pending[e.Job] = append(r.pending[e.Job], e)
+		}
+		// the log is replayed from the start, the older assignments go as it grows
+		r.prune(e.Time)
+	case EventFollowUp:
+		s.FollowUps++
+	case EventMessage:
+		s.Messages++
+	}
+}
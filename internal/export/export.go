@@ -0,0 +1,20 @@
+package export
+
+import (
+	"context"
+	"time"
+)
+
+// Metadata describes an exported clip, it is stored next to the exported video
+type Metadata struct {
+	Question  string    `json:"question"`
+	User      string    `json:"user,omitempty"`
+	Answer    string    `json:"answer"`
+	Source    string    `json:"source"`
+	VideoKey  string    `json:"video_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Exporter interface {
+	Export(ctx context.Context, videoPath string, metadata Metadata) (string, error)
+}
@@ -0,0 +1,223 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/llumus/lulis/internal/export"
+	"github.com/llumus/lulis/internal/fs"
+	"github.com/llumus/lulis/internal/media"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	width         = 1080
+	height        = 1920
+	titleHeight   = 420
+	titleFontSize = 60
+	titleWrap     = 26
+	keyPrefix     = "vertical/"
+)
+
+var log = logrus.New()
+
+// Exporter creates a vertical 9:16 version of a lip sync video, reframed on the face, with the question as a
+// title card, the answer as burned captions and an optional logo
+type Exporter struct {
+	basePath   string
+	logoPath   string
+	fontPath   string
+	faceCenter float64
+	fs         fs.FileSystem
+}
+
+// NewExporter faceCenter is the horizontal position of the face in the source video from 0 (left) to 1 (right)
+func NewExporter(basePath string, logoPath string, fontPath string, faceCenter float64, fs fs.FileSystem) *Exporter {
+	if faceCenter < 0 || faceCenter > 1 {
+		faceCenter = 0.5
+	}
+
+	return &Exporter{
+		basePath:   basePath,
+		logoPath:   logoPath,
+		fontPath:   fontPath,
+		faceCenter: faceCenter,
+		fs:         fs,
+	}
+}
+
+func (e *Exporter) Export(ctx context.Context, videoPath string, metadata export.Metadata) (string, error) {
+	var (
+		id           = uuid.NewString()
+		tmpDir       = filepath.Join(e.basePath, "tmp")
+		titlePath    = filepath.Join(tmpDir, id+"_title.txt")
+		captionsPath = filepath.Join(tmpDir, id+"_captions.srt")
+		outputPath   = filepath.Join(tmpDir, id+"_vertical.mp4")
+	)
+
+	defer func() {
+		for _, path := range []string{titlePath, captionsPath, outputPath} {
+			_ = os.Remove(path)
+		}
+	}()
+
+	duration, err := media.Duration(videoPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(titlePath, []byte(media.WrapText(metadata.Question, titleWrap)), 0644); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(captionsPath, []byte(buildCaptions(metadata.Answer, duration)), 0644); err != nil {
+		return "", err
+	}
+
+	args := []string{"-y", "-i", videoPath}
+	if e.logoPath != "" {
+		args = append(args, "-i", e.logoPath)
+	}
+
+	args = append(args,
+		"-filter_complex", e.filterGraph(titlePath, captionsPath),
+		"-map", "[out]",
+		"-map", "0:a?",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-movflags", "+faststart",
+		outputPath,
+	)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("error exporting vertical video: %w: %s", err, lastLines(output, 5))
+	}
+
+	videoKey, err := e.fs.Save(keyPrefix+id+".mp4", outputPath, "video/mp4")
+	if err != nil {
+		return "", err
+	}
+
+	metadata.Source = videoPath
+	metadata.VideoKey = videoKey
+	if metadata.CreatedAt.IsZero() {
+		metadata.CreatedAt = time.Now()
+	}
+
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := e.fs.SaveFile(keyPrefix+id+".json", bytes.NewReader(body), "application/json", int64(len(body))); err != nil {
+		return "", err
+	}
+
+	log.Infof("Exported vertical video %s from %s", videoKey, videoPath)
+
+	return videoKey, nil
+}
+
+// filterGraph crops a 9:16 window around the face, adds the title card on top, the captions at the bottom
+// and the logo on the bottom right corner when configured
+func (e *Exporter) filterGraph(titlePath, captionsPath string) string {
+	var font string
+	if e.fontPath != "" {
+		font = ":fontfile='" + e.fontPath + "'"
+	}
+
+	graph := fmt.Sprintf(
+		"[0:v]crop=w=ih*9/16:h=ih:x='min(max(iw*%s-ow/2,0),iw-ow)':y=0,scale=%d:%d,setsar=1,"+
+			"drawbox=x=0:y=0:w=iw:h=%d:color=black@0.75:t=fill,"+
+			"drawtext=textfile='%s'%s:fontcolor=white:fontsize=%d:line_spacing=14:x=(w-text_w)/2:y=(%d-text_h)/2,"+
+			"subtitles='%s':force_style='Alignment=2,FontSize=16,MarginV=70,Outline=2'",
+		strconv.FormatFloat(e.faceCenter, 'f', 3, 64), width, height,
+		titleHeight,
+		titlePath, font, titleFontSize, titleHeight,
+		captionsPath,
+	)
+
+	if e.logoPath == "" {
+		return graph + "[out]"
+	}
+
+	return graph + "[v];[1:v]scale=200:-1[logo];[v][logo]overlay=W-w-40:" + strconv.Itoa(titleHeight+40) + "[out]"
+}
+
+// buildCaptions splits the answer in sentences and spreads them over the video duration proportionally to their length
+func buildCaptions(answer string, duration float64) string {
+	sentences := splitSentences(answer)
+
+	var total int
+	for _, sentence := range sentences {
+		total += len([]rune(sentence))
+	}
+
+	if total == 0 {
+		return ""
+	}
+
+	var (
+		b     strings.Builder
+		start float64
+	)
+
+	for i, sentence := range sentences {
+		end := start + duration*float64(len([]rune(sentence)))/float64(total)
+		_, _ = fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, srtTime(start), srtTime(end), media.WrapText(sentence, 32))
+		start = end
+	}
+
+	return b.String()
+}
+
+func splitSentences(text string) []string {
+	var (
+		sentences []string
+		current   strings.Builder
+	)
+
+	for _, r := range text {
+		current.WriteRune(r)
+		if r == '.' || r == '!' || r == '?' {
+			if sentence := strings.TrimSpace(current.String()); sentence != "" {
+				sentences = append(sentences, sentence)
+			}
+			current.Reset()
+		}
+	}
+
+	if sentence := strings.TrimSpace(current.String()); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+
+	return sentences
+}
+
+func srtTime(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
+
+func lastLines(output []byte, count int) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+
+	return strings.Join(lines, "\n")
+}
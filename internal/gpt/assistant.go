@@ -0,0 +1,344 @@
+package gpt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/llumus/lulis/internal/action"
+	"github.com/llumus/lulis/internal/conversation"
+	"github.com/llumus/lulis/internal/cost"
+	"github.com/llumus/lulis/internal/knowledge"
+	"github.com/llumus/lulis/internal/language"
+	"github.com/llumus/lulis/internal/persona"
+	"github.com/llumus/lulis/internal/topics"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// Assistant implements GPT with the persona prompts on top of any chat completion backend
+type Assistant struct {
+	completer Completer
+	// maxAnswer is the default spoken duration budget of the answers, 0 for no budget
+	maxAnswer time.Duration
+}
+
+func NewAssistant(completer Completer, maxAnswer time.Duration) *Assistant {
+	return &Assistant{
+		completer: completer,
+		maxAnswer: maxAnswer,
+	}
+}
+
+func (a *Assistant) GenerateQuestion(ctx context.Context) (string, error) {
+	p, ok := persona.FromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("no persona to generate a question for")
+	}
+	p = render(ctx, p)
+
+	b, _ := topics.FromContext(ctx)
+	return a.send(ctx, QuestionMessages(p, b))
+}
+
+func (a *Assistant) GenerateResponse(ctx context.Context, question string) (string, error) {
+	p, ok := persona.FromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("no persona to answer %q", question)
+	}
+	p = render(ctx, p)
+
+	c, _ := conversation.FromContext(ctx)
+	passages, _ := knowledge.FromContext(ctx)
+	lang, _ := language.FromContext(ctx)
+	budget := a.budget(ctx, p)
+
+	req := Request{
+		Messages:  ResponseMessages(p, c, passages, question, budget.Words(), lang),
+		Saving:    saving(ctx),
+		MaxTokens: budget.MaxTokens(),
+		Tools:     tools(ctx),
+	}
+
+	completion, err := a.completer.Complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	record(ctx, completion)
+
+	// the model only called the actions, it is asked again for the answer with their results
+	if followUp, ok := act(ctx, req, completion); ok {
+		if completion, err = a.completer.Complete(ctx, followUp); err != nil {
+			return "", err
+		}
+		record(ctx, completion)
+	}
+
+	return a.fit(ctx, p, budget, completion), nil
+}
+
+// tools are the actions of the plan of the answer, none without a plan
+func tools(ctx context.Context) []Tool {
+	plan, ok := action.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var tools []Tool
+	for _, a := range plan.Actions() {
+		tools = append(tools, Tool{Name: a.Name, Description: a.Description, Parameters: a.Parameters})
+	}
+
+	return tools
+}
+
+// act plans the actions called by the model, when there is no answer with them the follow up request asks for
+// it with the results of the calls and without more calls
+func act(ctx context.Context, req Request, completion Completion) (Request, bool) {
+	plan, ok := action.FromContext(ctx)
+	if !ok || len(completion.ToolCalls) == 0 {
+		return Request{}, false
+	}
+
+	results := make([]Message, 0, len(completion.ToolCalls))
+	for _, call := range completion.ToolCalls {
+		results = append(results, Message{Role: RoleTool, Content: plan.Request(call.Name, call.Arguments), ToolCallID: call.ID})
+	}
+
+	if strings.TrimSpace(completion.Content) != "" {
+		return Request{}, false
+	}
+
+	messages := append([]Message{}, req.Messages...)
+	messages = append(messages, Message{Role: RoleAssistant, Content: completion.Content, ToolCalls: completion.ToolCalls})
+	req.Messages = append(messages, results...)
+	req.ToolChoice = "none"
+	return req, true
+}
+
+// budget of the answers of the persona, scaled down when saving
+func (a *Assistant) budget(ctx context.Context, p *persona.Persona) Budget {
+	budget := BudgetFor(p, a.maxAnswer)
+	if saving, ok := cost.SavingFromContext(ctx); ok && saving.AnswerRatio > 0 {
+		budget.MaxDuration = time.Duration(float64(budget.MaxDuration) * saving.AnswerRatio)
+	}
+
+	return budget
+}
+
+// saving is true when the completions should use the cheaper model of the providers
+func saving(ctx context.Context) bool {
+	_, ok := cost.SavingFromContext(ctx)
+	return ok
+}
+
+// fit the answer in the budget, an answer too long or cut by the max tokens is shortened by the model and
+// truncated at a sentence boundary if it is still too long
+func (a *Assistant) fit(ctx context.Context, p *persona.Persona, budget Budget, completion Completion) string {
+	answer := completion.Content
+	if budget.Fits(answer) && completion.FinishReason != "length" {
+		return answer
+	}
+
+	log.Warnf("Answer over the %s budget (about %s, finish reason %q), shortening it", budget.MaxDuration, budget.Duration(answer), completion.FinishReason)
+
+	shortened, err := a.send(ctx, ShortenMessages(p, answer, budget.Words()))
+	switch {
+	case err != nil:
+		log.Errorf("Error shortening the answer: %v", err)
+		if completion.FinishReason == "length" {
+			answer = completeSentences(answer)
+		}
+	case shortened != "":
+		answer = shortened
+	}
+
+	if !budget.Fits(answer) {
+		answer = budget.Truncate(answer)
+		log.Warnf("Answer truncated to about %s", budget.Duration(answer))
+	}
+
+	return answer
+}
+
+func (a *Assistant) GenerateDialogue(ctx context.Context, topic string, personas []*persona.Persona, turns int) ([]DialogueLine, error) {
+	rendered := make([]*persona.Persona, 0, len(personas))
+	for _, p := range personas {
+		rendered = append(rendered, render(ctx, p))
+	}
+	personas = rendered
+
+	script, err := a.send(ctx, DialogueMessages(personas, topic, turns))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := ParseDialogue(script, personas)
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no dialogue lines in the script: %s", script)
+	}
+
+	return lines, nil
+}
+
+func (a *Assistant) SummarizeConversation(ctx context.Context, summary string, turns []conversation.Turn) (string, error) {
+	return a.send(ctx, SummaryMessages(summary, turns))
+}
+
+func (a *Assistant) send(ctx context.Context, messages []Message) (string, error) {
+	completion, err := a.completer.Complete(ctx, Request{Messages: messages, Saving: saving(ctx)})
+	if err != nil {
+		return "", err
+	}
+	record(ctx, completion)
+
+	return completion.Content, nil
+}
+
+// record the tokens of the completion in the cost ledger
+func record(ctx context.Context, completion Completion) {
+	provider := completion.Provider
+	if provider == "" {
+		provider = "llm"
+	}
+
+	cost.Record(ctx, provider, completion.Model, cost.UnitPromptTokens, float64(completion.Usage.PromptTokens))
+	cost.Record(ctx, provider, completion.Model, cost.UnitCompletionTokens, float64(completion.Usage.CompletionTokens))
+
+	if served, ok := ctx.Value(servedKey{}).(func(provider string)); ok && completion.Provider != "" {
+		served(completion.Provider)
+	}
+}
+
+func (a *Assistant) StreamResponse(ctx context.Context, question string, onSentence func(sentence string)) (string, error) {
+	streamer, ok := a.completer.(StreamCompleter)
+	if !ok {
+		answer, err := a.GenerateResponse(ctx, question)
+		if err != nil {
+			return "", err
+		}
+
+		for _, sentence := range Sentences(answer) {
+			onSentence(sentence)
+		}
+		return answer, nil
+	}
+
+	p, ok := persona.FromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("no persona to answer %q", question)
+	}
+	p = render(ctx, p)
+
+	c, _ := conversation.FromContext(ctx)
+	passages, _ := knowledge.FromContext(ctx)
+	lang, _ := language.FromContext(ctx)
+	budget := a.budget(ctx, p)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := &sentenceStream{budget: budget, onSentence: onSentence, stop: cancel}
+	req := Request{
+		Messages:  ResponseMessages(p, c, passages, question, budget.Words(), lang),
+		Saving:    saving(ctx),
+		MaxTokens: budget.MaxTokens(),
+		Tools:     tools(ctx),
+	}
+
+	completion, err := streamer.CompleteStream(ctx, req, s.write)
+	// a stream stopped early has no usage, its tokens are not accounted
+	record(ctx, completion)
+
+	if err == nil {
+		if followUp, ok := act(ctx, req, completion); ok {
+			completion, err = streamer.CompleteStream(ctx, followUp, s.write)
+			record(ctx, completion)
+		}
+	}
+
+	switch {
+	case s.full:
+		log.Warnf("Streamed answer over the %s budget, stopped at about %s", budget.MaxDuration, budget.Duration(s.answer()))
+	case err != nil && len(s.sentences) == 0:
+		return "", err
+	case err != nil:
+		log.Errorf("Error streaming the answer, keeping the %d sentences already generated: %v", len(s.sentences), err)
+	case completion.FinishReason == "length" && len(s.sentences) > 0:
+		log.Warnf("Streamed answer cut by the max tokens, dropping its unfinished sentence")
+	default:
+		s.flush()
+	}
+
+	return s.answer(), nil
+}
+
+// sentenceStream splits the streamed deltas in sentences within the budget, the generation is stopped once
+// the budget is spent
+type sentenceStream struct {
+	budget     Budget
+	onSentence func(sentence string)
+	stop       func()
+
+	buffer    strings.Builder
+	sentences []string
+	words     int
+	full      bool
+}
+
+func (s *sentenceStream) write(delta string) {
+	if s.full {
+		return
+	}
+
+	s.buffer.WriteString(delta)
+
+	// the last sentence may not be finished yet, it stays in the buffer
+	sentences := Sentences(s.buffer.String())
+	if len(sentences) < 2 {
+		return
+	}
+
+	for _, sentence := range sentences[:len(sentences)-1] {
+		s.emit(sentence)
+	}
+
+	s.buffer.Reset()
+	s.buffer.WriteString(sentences[len(sentences)-1])
+}
+
+// flush the last sentence once the stream is done
+func (s *sentenceStream) flush() {
+	if sentence := strings.TrimSpace(s.buffer.String()); sentence != "" && !s.full {
+		s.emit(sentence)
+	}
+	s.buffer.Reset()
+}
+
+func (s *sentenceStream) emit(sentence string) {
+	if s.full {
+		return
+	}
+
+	words := len(strings.Fields(sentence))
+	if !s.budget.Unlimited() && s.words+words > s.budget.Words() {
+		s.full = true
+		s.stop()
+
+		// a first sentence too long alone is cut, otherwise the answer ends with the previous sentence
+		if len(s.sentences) > 0 {
+			return
+		}
+		sentence = s.budget.Truncate(sentence)
+	}
+
+	s.sentences = append(s.sentences, sentence)
+	s.words += words
+	s.onSentence(sentence)
+}
+
+func (s *sentenceStream) answer() string {
+	return strings.Join(s.sentences, " ")
+}
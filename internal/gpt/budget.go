@@ -0,0 +1,147 @@
+package gpt
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/llumus/lulis/internal/persona"
+)
+
+// DefaultWordsPerSecond is the speaking rate of the voices without a rate of their own, about 150 words a minute
+const DefaultWordsPerSecond = 2.5
+
+// tokensPerWord is a rough average of the OpenAI tokenizers over English and Portuguese texts, the max tokens
+// leave a margin over it so the answer can end its sentence, the truncation takes care of the rest
+const (
+	tokensPerWord   = 1.6
+	maxTokensMargin = 1.3
+)
+
+// Budget is how long an answer can take to be spoken by the voice of the persona
+type Budget struct {
+	MaxDuration    time.Duration
+	WordsPerSecond float64
+}
+
+// BudgetFor the persona, its own max duration and speaking rate win over the default max duration
+func BudgetFor(p *persona.Persona, maxDuration time.Duration) Budget {
+	b := Budget{MaxDuration: maxDuration, WordsPerSecond: DefaultWordsPerSecond}
+	if p.MaxAnswerSeconds > 0 {
+		b.MaxDuration = time.Duration(p.MaxAnswerSeconds * float64(time.Second))
+	}
+
+	if p.WordsPerSecond > 0 {
+		b.WordsPerSecond = p.WordsPerSecond
+	}
+
+	return b
+}
+
+// Unlimited when there is no max duration
+func (b Budget) Unlimited() bool {
+	return b.MaxDuration <= 0
+}
+
+// Words that fit in the budget
+func (b Budget) Words() int {
+	return int(b.MaxDuration.Seconds() * b.WordsPerSecond)
+}
+
+// MaxTokens of the completion for the budget, 0 when unlimited
+func (b Budget) MaxTokens() int {
+	if b.Unlimited() {
+		return 0
+	}
+
+	return int(math.Ceil(float64(b.Words()) * tokensPerWord * maxTokensMargin))
+}
+
+// Duration estimate of the text spoken by the voice
+func (b Budget) Duration(text string) time.Duration {
+	return time.Duration(float64(len(strings.Fields(text))) / b.WordsPerSecond * float64(time.Second))
+}
+
+func (b Budget) Fits(text string) bool {
+	return b.Unlimited() || len(strings.Fields(text)) <= b.Words()
+}
+
+// Truncate the text to the whole sentences fitting in the budget, a first sentence too long alone is cut at a word
+func (b Budget) Truncate(text string) string {
+	if b.Fits(text) {
+		return text
+	}
+
+	var (
+		kept  []string
+		words int
+	)
+
+	for _, sentence := range Sentences(text) {
+		count := len(strings.Fields(sentence))
+		if words+count > b.Words() {
+			break
+		}
+
+		kept = append(kept, sentence)
+		words += count
+	}
+
+	if len(kept) > 0 {
+		return strings.Join(kept, " ")
+	}
+
+	fields := strings.Fields(text)
+	return strings.TrimRight(strings.Join(fields[:b.Words()], " "), ",;:") + "..."
+}
+
+// Sentences of the text, ending with their punctuation
+func Sentences(text string) []string {
+	var (
+		sentences []string
+		current   strings.Builder
+		runes     = []rune(text)
+	)
+
+	for i, r := range runes {
+		current.WriteRune(r)
+
+		end := r == '.' || r == '!' || r == '?' || r == '\n'
+		// keep "..." and "?!" together, and don't split numbers like 3.5, a new line always ends the sentence
+		if end && r != '\n' && i+1 < len(runes) && !isSpace(runes[i+1]) {
+			end = false
+		}
+
+		if end {
+			if sentence := strings.TrimSpace(current.String()); sentence != "" {
+				sentences = append(sentences, sentence)
+			}
+			current.Reset()
+		}
+	}
+
+	if sentence := strings.TrimSpace(current.String()); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+
+	return sentences
+}
+
+// completeSentences drops the last sentence of a text cut in the middle of it, unless it is the only one
+func completeSentences(text string) string {
+	sentences := Sentences(text)
+	if len(sentences) < 2 {
+		return text
+	}
+
+	last := []rune(sentences[len(sentences)-1])
+	if strings.ContainsRune(".!?", last[len(last)-1]) {
+		return text
+	}
+
+	return strings.Join(sentences[:len(sentences)-1], " ")
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\t' || r == '\r'
+}
@@ -0,0 +1,98 @@
+package gpt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llumus/lulis/internal/persona"
+)
+
+func TestBudgetFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		persona persona.Persona
+		want    Budget
+	}{
+		{"default", persona.Persona{}, Budget{MaxDuration: 90 * time.Second, WordsPerSecond: DefaultWordsPerSecond}},
+		{"persona", persona.Persona{MaxAnswerSeconds: 30, WordsPerSecond: 2}, Budget{MaxDuration: 30 * time.Second, WordsPerSecond: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BudgetFor(&tt.persona, 90*time.Second); got != tt.want {
+				t.Errorf("BudgetFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	// 5 words
+	budget := Budget{MaxDuration: 5 * time.Second, WordsPerSecond: 1}
+
+	tests := []struct {
+		name   string
+		budget Budget
+		text   string
+		want   string
+	}{
+		{"fits", budget, "One two three. Four five.", "One two three. Four five."},
+		{"unlimited", Budget{WordsPerSecond: 1}, "One two three four five six seven.", "One two three four five six seven."},
+		{"whole sentences", budget, "One two. Three four! Five six? Seven.", "One two. Three four!"},
+		{"first sentence too long", budget, "One, two, three, four, five, six, seven. Eight.", "One, two, three, four, five..."},
+		{"ellipsis and decimals", budget, "It costs 3.5 dollars... Or more.", "It costs 3.5 dollars..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.budget.Truncate(tt.text)
+			if got != tt.want {
+				t.Errorf("Truncate() = %q, want %q", got, tt.want)
+			}
+			if !tt.budget.Fits(strings.TrimSuffix(got, "...")) {
+				t.Errorf("Truncate() = %q does not fit in %d words", got, tt.budget.Words())
+			}
+		})
+	}
+}
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"punctuation", "Hi! How are you? Fine.", []string{"Hi!", "How are you?", "Fine."}},
+		{"kept together", "Wait... what?! It is 3.5 km", []string{"Wait...", "what?!", "It is 3.5 km"}},
+		{"new lines", "First line\nSecond line\n", []string{"First line", "Second line"}},
+		{"empty", "  ", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sentences(tt.text); strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("Sentences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleteSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"One sentence. And a cut", "One sentence."},
+		{"A cut one", "A cut one"},
+		{"Two. Sentences!", "Two. Sentences!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := completeSentences(tt.text); got != tt.want {
+				t.Errorf("completeSentences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
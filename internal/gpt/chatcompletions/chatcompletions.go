@@ -0,0 +1,373 @@
+package chatcompletions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/llumus/lulis/internal/gpt"
+)
+
+const (
+	OpenAIBaseURL   = "https://api.openai.com/v1"
+	OllamaBaseURL   = "http://localhost:11434/v1"
+	LlamaCppBaseURL = "http://localhost:8080/v1"
+)
+
+const defaultTimeout = 2 * time.Minute
+
+type Config struct {
+	// BaseURL of the api without the /chat/completions path, e.g. http://localhost:11434/v1
+	BaseURL string
+	// APIKey is sent as a bearer token when set, local servers usually don't need one
+	APIKey string
+	Model  string
+	// BudgetModel replaces Model for the requests saving, Model is kept when empty
+	BudgetModel string
+	Temperature float64
+	MaxTokens   int
+	Timeout     time.Duration
+}
+
+type message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type toolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function functionCall `json:"function"`
+}
+
+type functionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type tool struct {
+	Type     string   `json:"type"`
+	Function function `json:"function"`
+}
+
+type function struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type request struct {
+	Model         string         `json:"model"`
+	Messages      []message      `json:"messages"`
+	Temperature   float64        `json:"temperature,omitempty"`
+	MaxTokens     int            `json:"max_tokens,omitempty"`
+	Tools         []tool         `json:"tools,omitempty"`
+	ToolChoice    string         `json:"tool_choice,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type choice struct {
+	Message      message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+type response struct {
+	Model   string    `json:"model"`
+	Choices []choice  `json:"choices"`
+	Usage   gpt.Usage `json:"usage"`
+}
+
+// deltaMessage is a piece of the message, the tool calls come in pieces too, merged by their index
+type deltaMessage struct {
+	Content   string `json:"content"`
+	ToolCalls []struct {
+		Index    int          `json:"index"`
+		ID       string       `json:"id"`
+		Function functionCall `json:"function"`
+	} `json:"tool_calls"`
+}
+
+type delta struct {
+	Delta        deltaMessage `json:"delta"`
+	FinishReason string       `json:"finish_reason"`
+}
+
+type chunk struct {
+	Model   string     `json:"model"`
+	Choices []delta    `json:"choices"`
+	Usage   *gpt.Usage `json:"usage"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ChatCompletions completes with any OpenAI compatible /chat/completions endpoint, OpenAI itself, Ollama,
+// a llama.cpp server or a stub server for tests
+type ChatCompletions struct {
+	config Config
+	client *http.Client
+}
+
+func NewChatCompletions(config Config) *ChatCompletions {
+	if config.BaseURL == "" {
+		config.BaseURL = OpenAIBaseURL
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return &ChatCompletions{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+func (c *ChatCompletions) Complete(ctx context.Context, req gpt.Request) (gpt.Completion, error) {
+	body := c.request(req)
+
+	resp, err := c.post(ctx, body)
+	if err != nil {
+		return gpt.Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return gpt.Completion{}, err
+	}
+
+	var res response
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return gpt.Completion{}, fmt.Errorf("error decoding chat completion: %w", err)
+	}
+
+	completion := gpt.Completion{
+		Model: res.Model,
+		Usage: res.Usage,
+	}
+
+	if completion.Model == "" {
+		completion.Model = body.Model
+	}
+
+	if len(res.Choices) == 0 {
+		return completion, nil
+	}
+
+	completion.Content = res.Choices[0].Message.Content
+	completion.FinishReason = res.Choices[0].FinishReason
+	for _, call := range res.Choices[0].Message.ToolCalls {
+		completion.ToolCalls = append(completion.ToolCalls, gpt.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
+	return completion, nil
+}
+
+// CompleteStream reads the server sent events of the completion, the usage is only known when the server
+// supports stream_options
+func (c *ChatCompletions) CompleteStream(ctx context.Context, req gpt.Request, onDelta func(delta string)) (gpt.Completion, error) {
+	body := c.request(req)
+	body.Stream = true
+	body.StreamOptions = &streamOptions{IncludeUsage: true}
+
+	resp, err := c.post(ctx, body)
+	if err != nil {
+		return gpt.Completion{}, err
+	}
+	defer resp.Body.Close()
+
+	var (
+		completion = gpt.Completion{Model: body.Model}
+		content    strings.Builder
+		calls      = make(map[int]*gpt.ToolCall)
+		scanner    = bufio.NewScanner(resp.Body)
+	)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var ch chunk
+		if err := json.Unmarshal([]byte(data), &ch); err != nil {
+			return completion, fmt.Errorf("error decoding chat completion chunk: %w", err)
+		}
+
+		if ch.Model != "" {
+			completion.Model = ch.Model
+		}
+
+		if ch.Usage != nil {
+			completion.Usage = *ch.Usage
+		}
+
+		for _, choice := range ch.Choices {
+			if choice.FinishReason != "" {
+				completion.FinishReason = choice.FinishReason
+			}
+
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				onDelta(choice.Delta.Content)
+			}
+
+			for _, piece := range choice.Delta.ToolCalls {
+				call, ok := calls[piece.Index]
+				if !ok {
+					call = &gpt.ToolCall{}
+					calls[piece.Index] = call
+				}
+
+				if piece.ID != "" {
+					call.ID = piece.ID
+				}
+				call.Name += piece.Function.Name
+				call.Arguments += piece.Function.Arguments
+			}
+		}
+	}
+
+	completion.Content = content.String()
+	completion.ToolCalls = toolCalls(calls)
+	if err := scanner.Err(); err != nil {
+		return completion, err
+	}
+
+	return completion, nil
+}
+
+// toolCalls in the order of their index
+func toolCalls(calls map[int]*gpt.ToolCall) []gpt.ToolCall {
+	indexes := make([]int, 0, len(calls))
+	for index := range calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	list := make([]gpt.ToolCall, 0, len(indexes))
+	for _, index := range indexes {
+		list = append(list, *calls[index])
+	}
+
+	return list
+}
+
+// request with the defaults of the config for the values the request leaves empty
+func (c *ChatCompletions) request(req gpt.Request) request {
+	body := request{
+		Model:       c.config.Model,
+		Messages:    make([]message, 0, len(req.Messages)),
+		Temperature: c.config.Temperature,
+		MaxTokens:   c.config.MaxTokens,
+	}
+
+	for _, m := range req.Messages {
+		msg := message{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, toolCall{
+				ID:       call.ID,
+				Type:     "function",
+				Function: functionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+		body.Messages = append(body.Messages, msg)
+	}
+
+	for _, t := range req.Tools {
+		body.Tools = append(body.Tools, tool{
+			Type:     "function",
+			Function: function{Name: t.Name, Description: t.Description, Parameters: t.Parameters},
+		})
+	}
+
+	if len(body.Tools) > 0 {
+		body.ToolChoice = req.ToolChoice
+	}
+
+	if req.Saving && c.config.BudgetModel != "" {
+		body.Model = c.config.BudgetModel
+	}
+
+	if req.Model != "" {
+		body.Model = req.Model
+	}
+
+	if req.Temperature != 0 {
+		body.Temperature = req.Temperature
+	}
+
+	if req.MaxTokens != 0 {
+		body.MaxTokens = req.MaxTokens
+	}
+
+	return body
+}
+
+// post the request, a non 2xx status is returned as a gpt.StatusError
+func (c *ChatCompletions) post(ctx context.Context, body request) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+
+		var errResp errorResponse
+		message := strings.TrimSpace(string(respBody))
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error.Message != "" {
+			message = errResp.Error.Message
+		}
+
+		return nil, &gpt.StatusError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	return resp, nil
+}
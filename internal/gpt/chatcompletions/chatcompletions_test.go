@@ -0,0 +1,196 @@
+package chatcompletions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/llumus/lulis/internal/gpt"
+)
+
+// server answers the chat completions with handler and keeps the last request it received
+func server(t *testing.T, handler func(w http.ResponseWriter, body request)) (*httptest.Server, *request, *http.Header) {
+	t.Helper()
+
+	var (
+		got    request
+		header http.Header
+	)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %s, want /chat/completions", r.URL.Path)
+		}
+
+		header = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+
+		handler(w, got)
+	}))
+	t.Cleanup(s.Close)
+
+	return s, &got, &header
+}
+
+func TestComplete(t *testing.T) {
+	s, got, header := server(t, func(w http.ResponseWriter, _ request) {
+		_, _ = fmt.Fprint(w, `{
+			"model": "gpt-4-0613",
+			"choices": [{
+				"message": {
+					"role": "assistant",
+					"content": "Hello!",
+					"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "show_image", "arguments": "{\"image\":\"flag\"}"}}]
+				},
+				"finish_reason": "stop"
+			}],
+			"usage": {"prompt_tokens": 10, "completion_tokens": 3, "total_tokens": 13}
+		}`)
+	})
+
+	c := NewChatCompletions(Config{BaseURL: s.URL + "/", APIKey: "key", Model: "gpt-4", Temperature: 0.7, MaxTokens: 200})
+	completion, err := c.Complete(context.Background(), gpt.Request{
+		Messages:  []gpt.Message{{Role: gpt.RoleUser, Content: "Hi"}},
+		MaxTokens: 50,
+		Tools:     []gpt.Tool{{Name: "show_image", Parameters: json.RawMessage(`{"type":"object"}`)}},
+	})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	if got.Model != "gpt-4" || got.Temperature != 0.7 || got.MaxTokens != 50 {
+		t.Errorf("request model %q temperature %v max tokens %d, want gpt-4 0.7 50", got.Model, got.Temperature, got.MaxTokens)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Function.Name != "show_image" {
+		t.Errorf("request tools = %+v", got.Tools)
+	}
+	if auth := header.Get("Authorization"); auth != "Bearer key" {
+		t.Errorf("Authorization = %q, want Bearer key", auth)
+	}
+
+	if completion.Content != "Hello!" || completion.Model != "gpt-4-0613" || completion.FinishReason != "stop" {
+		t.Errorf("completion = %+v", completion)
+	}
+	if completion.Usage.TotalTokens != 13 {
+		t.Errorf("usage = %+v, want 13 total tokens", completion.Usage)
+	}
+	if len(completion.ToolCalls) != 1 || completion.ToolCalls[0].Arguments != `{"image":"flag"}` {
+		t.Errorf("tool calls = %+v", completion.ToolCalls)
+	}
+}
+
+func TestBudgetModel(t *testing.T) {
+	s, got, _ := server(t, func(w http.ResponseWriter, _ request) {
+		_, _ = fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Hi"}}]}`)
+	})
+
+	tests := []struct {
+		name   string
+		config Config
+		req    gpt.Request
+		model  string
+	}{
+		{"not saving", Config{Model: "gpt-4", BudgetModel: "gpt-4o-mini"}, gpt.Request{}, "gpt-4"},
+		{"saving", Config{Model: "gpt-4", BudgetModel: "gpt-4o-mini"}, gpt.Request{Saving: true}, "gpt-4o-mini"},
+		{"saving without budget model", Config{Model: "llama3"}, gpt.Request{Saving: true}, "llama3"},
+		{"request model", Config{Model: "gpt-4", BudgetModel: "gpt-4o-mini"}, gpt.Request{Saving: true, Model: "gpt-4o"}, "gpt-4o"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.BaseURL = s.URL
+			if _, err := NewChatCompletions(tt.config).Complete(context.Background(), tt.req); err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+
+			if got.Model != tt.model {
+				t.Errorf("model = %q, want %q", got.Model, tt.model)
+			}
+		})
+	}
+}
+
+func TestCompleteStream(t *testing.T) {
+	s, got, _ := server(t, func(w http.ResponseWriter, _ request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, data := range []string{
+			`{"model":"llama3","choices":[{"delta":{"content":"Hello"}}]}`,
+			`{"choices":[{"delta":{"content":" there."}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"start_poll","arguments":"{\"q"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\":1}"}}]},"finish_reason":"stop"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+			`[DONE]`,
+		} {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+	})
+
+	var deltas []string
+	c := NewChatCompletions(Config{BaseURL: s.URL, Model: "llama3"})
+	completion, err := c.CompleteStream(context.Background(), gpt.Request{
+		Messages: []gpt.Message{{Role: gpt.RoleUser, Content: "Hi"}},
+	}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+
+	if !got.Stream || got.StreamOptions == nil || !got.StreamOptions.IncludeUsage {
+		t.Errorf("request stream %v options %+v, want a stream with the usage", got.Stream, got.StreamOptions)
+	}
+
+	if strings.Join(deltas, "|") != "Hello| there." || completion.Content != "Hello there." {
+		t.Errorf("deltas = %q content = %q", deltas, completion.Content)
+	}
+	if completion.FinishReason != "stop" || completion.Usage.TotalTokens != 7 {
+		t.Errorf("completion = %+v", completion)
+	}
+	if len(completion.ToolCalls) != 1 || completion.ToolCalls[0].Name != "start_poll" || completion.ToolCalls[0].Arguments != `{"q":1}` {
+		t.Errorf("tool calls = %+v", completion.ToolCalls)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		message   string
+		retryable bool
+	}{
+		{"rate limit", http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached"}}`, "Rate limit reached", true},
+		{"server error", http.StatusBadGateway, "bad gateway", "bad gateway", true},
+		{"bad request", http.StatusBadRequest, `{"error":{"message":"Unknown model"}}`, "Unknown model", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, _ := server(t, func(w http.ResponseWriter, _ request) {
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, tt.body)
+			})
+
+			c := NewChatCompletions(Config{BaseURL: s.URL, Model: "gpt-4"})
+			_, err := c.Complete(context.Background(), gpt.Request{Messages: []gpt.Message{{Role: gpt.RoleUser, Content: "Hi"}}})
+
+			var statusErr *gpt.StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("Complete() error = %v, want a *gpt.StatusError", err)
+			}
+			if statusErr.StatusCode != tt.status || statusErr.Message != tt.message {
+				t.Errorf("StatusError = %d %q, want %d %q", statusErr.StatusCode, statusErr.Message, tt.status, tt.message)
+			}
+			if gpt.Retryable(err) != tt.retryable {
+				t.Errorf("Retryable() = %v, want %v", gpt.Retryable(err), tt.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package gpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Request is a chat completion request, zero values use the completer defaults
+type Request struct {
+	Messages    []Message
+	Model       string
+	Temperature float64
+	MaxTokens   int
+	// Saving asks for the cheaper model of the completer when it has one, Model still wins
+	Saving bool
+	// Tools the model can call, ignored by the completers without function calling
+	Tools []Tool
+	// ToolChoice is "none" to forbid calling the tools, the model decides by default
+	ToolChoice string
+}
+
+// Tool is a function the model can call, Parameters is the json schema of its arguments
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// ToolCall is a call of a tool requested by the model, Arguments is a json object
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Completion struct {
+	Content      string
+	Model        string
+	FinishReason string
+	// Provider is the name of the backend that served the completion when several are chained
+	Provider string
+	Usage    Usage
+	// ToolCalls requested by the model, with or without content
+	ToolCalls []ToolCall
+}
+
+// Completer is a chat completion backend, the prompts are built by the Assistant
+type Completer interface {
+	Complete(ctx context.Context, req Request) (Completion, error)
+}
+
+// StreamCompleter streams the completion, onDelta gets the content as it is generated
+type StreamCompleter interface {
+	Completer
+	CompleteStream(ctx context.Context, req Request, onDelta func(delta string)) (Completion, error)
+}
+
+// StatusError is returned by the completers when the api answers with a non 2xx status
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("chat completions status %d: %s", e.StatusCode, e.Message)
+}
+
+// Retryable errors are rate limits and server errors, worth another try after a while
+func Retryable(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,305 @@
+package fallback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/gpt"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// DefaultPolicy is used when the fallback is created with a zero policy
+var DefaultPolicy = Policy{
+	Retries:          2,
+	InitialBackoff:   time.Second,
+	MaxBackoff:       15 * time.Second,
+	FailureThreshold: 3,
+	OpenInterval:     2 * time.Minute,
+}
+
+// Policy of the retries of a provider and of its circuit breaker
+type Policy struct {
+	// Retries of a provider on rate limits and server errors before moving to the next one
+	Retries        int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// FailureThreshold consecutive failures open the circuit, the provider is skipped for OpenInterval
+	FailureThreshold int
+	OpenInterval     time.Duration
+}
+
+// Provider is a named completer of the chain
+type Provider struct {
+	Name      string
+	Completer gpt.Completer
+}
+
+// State of the circuit breaker of a provider
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half-open"
+)
+
+type ProviderStatus struct {
+	State       State     `json:"state"`
+	Failures    int       `json:"failures"`
+	LastError   string    `json:"last_error,omitempty"`
+	OpenedAt    time.Time `json:"opened_at,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+}
+
+type breaker struct {
+	provider Provider
+	status   ProviderStatus
+}
+
+// Fallback tries the providers in order, a provider failing FailureThreshold times in a row is skipped until
+// OpenInterval passes, then a single completion is let through to check whether it recovered
+type Fallback struct {
+	policy Policy
+
+	mu       sync.Mutex
+	breakers []*breaker
+}
+
+func NewFallback(policy Policy, providers ...Provider) *Fallback {
+	if policy == (Policy{}) {
+		policy = DefaultPolicy
+	}
+
+	breakers := make([]*breaker, 0, len(providers))
+	for _, provider := range providers {
+		breakers = append(breakers, &breaker{provider: provider, status: ProviderStatus{State: StateClosed}})
+	}
+
+	return &Fallback{
+		policy:   policy,
+		breakers: breakers,
+	}
+}
+
+func (f *Fallback) Complete(ctx context.Context, req gpt.Request) (gpt.Completion, error) {
+	var errs []error
+
+	for _, b := range f.breakers {
+		if !f.allow(b) {
+			log.Debugf("Skipping provider %s, circuit open", b.provider.Name)
+			continue
+		}
+
+		completion, err := f.complete(ctx, b.provider, req)
+		if err == nil {
+			f.succeed(b)
+			completion.Provider = b.provider.Name
+			log.Infof("Completion served by %s (%s, %d tokens)", b.provider.Name, completion.Model, completion.Usage.TotalTokens)
+			return completion, nil
+		}
+
+		if ctx.Err() != nil {
+			f.abort(b)
+			return gpt.Completion{}, ctx.Err()
+		}
+
+		f.fail(b, err)
+		log.Warnf("Provider %s failed: %v", b.provider.Name, err)
+		errs = append(errs, fmt.Errorf("%s: %w", b.provider.Name, err))
+	}
+
+	if len(errs) == 0 {
+		return gpt.Completion{}, fmt.Errorf("no provider available, all circuits are open")
+	}
+
+	return gpt.Completion{}, errors.Join(errs...)
+}
+
+// CompleteStream like Complete, a provider failing once its deltas started flowing can't be replaced by the next
+// one, the error is returned, the providers without streaming send the whole completion as a single delta
+func (f *Fallback) CompleteStream(ctx context.Context, req gpt.Request, onDelta func(delta string)) (gpt.Completion, error) {
+	var errs []error
+
+	for _, b := range f.breakers {
+		if !f.allow(b) {
+			log.Debugf("Skipping provider %s, circuit open", b.provider.Name)
+			continue
+		}
+
+		var started bool
+		completion, err := f.completeStream(ctx, b.provider, req, func(delta string) {
+			started = true
+			onDelta(delta)
+		})
+
+		if err == nil {
+			f.succeed(b)
+			completion.Provider = b.provider.Name
+			log.Infof("Streamed completion served by %s (%s, %d tokens)", b.provider.Name, completion.Model, completion.Usage.TotalTokens)
+			return completion, nil
+		}
+
+		if ctx.Err() != nil {
+			f.abort(b)
+			completion.Provider = b.provider.Name
+			return completion, ctx.Err()
+		}
+
+		f.fail(b, err)
+		log.Warnf("Provider %s failed: %v", b.provider.Name, err)
+		if started {
+			completion.Provider = b.provider.Name
+			return completion, fmt.Errorf("%s: %w", b.provider.Name, err)
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", b.provider.Name, err))
+	}
+
+	if len(errs) == 0 {
+		return gpt.Completion{}, fmt.Errorf("no provider available, all circuits are open")
+	}
+
+	return gpt.Completion{}, errors.Join(errs...)
+}
+
+// completeStream with the retries of the policy as long as nothing was streamed
+func (f *Fallback) completeStream(ctx context.Context, provider Provider, req gpt.Request, onDelta func(delta string)) (gpt.Completion, error) {
+	streamer, ok := provider.Completer.(gpt.StreamCompleter)
+	if !ok {
+		completion, err := f.complete(ctx, provider, req)
+		if err == nil && completion.Content != "" {
+			onDelta(completion.Content)
+		}
+		return completion, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var started bool
+		completion, err := streamer.CompleteStream(ctx, req, func(delta string) {
+			started = true
+			onDelta(delta)
+		})
+
+		if err == nil || started || !gpt.Retryable(err) || attempt >= f.policy.Retries {
+			return completion, err
+		}
+
+		delay := f.backoff(attempt)
+		log.Warnf("Provider %s failed (attempt %d), retrying in %s: %v", provider.Name, attempt+1, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return gpt.Completion{}, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Status of the circuit breaker of every provider by name
+func (f *Fallback) Status() map[string]ProviderStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := make(map[string]ProviderStatus, len(f.breakers))
+	for _, b := range f.breakers {
+		status[b.provider.Name] = b.status
+	}
+
+	return status
+}
+
+// complete with the retries of the policy on rate limits and server errors
+func (f *Fallback) complete(ctx context.Context, provider Provider, req gpt.Request) (gpt.Completion, error) {
+	for attempt := 0; ; attempt++ {
+		completion, err := provider.Completer.Complete(ctx, req)
+		if err == nil || !gpt.Retryable(err) || attempt >= f.policy.Retries {
+			return completion, err
+		}
+
+		delay := f.backoff(attempt)
+		log.Warnf("Provider %s failed (attempt %d), retrying in %s: %v", provider.Name, attempt+1, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return gpt.Completion{}, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (f *Fallback) backoff(attempt int) time.Duration {
+	delay := time.Duration(float64(f.policy.InitialBackoff) * math.Pow(2, float64(attempt)))
+	if f.policy.MaxBackoff > 0 && delay > f.policy.MaxBackoff {
+		delay = f.policy.MaxBackoff
+	}
+
+	return delay
+}
+
+// allow a completion with the provider, an open circuit becomes half open after OpenInterval
+func (f *Fallback) allow(b *breaker) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch b.status.State {
+	case StateOpen:
+		if time.Since(b.status.OpenedAt) < f.policy.OpenInterval {
+			return false
+		}
+
+		log.Infof("Provider %s circuit half open, trying again", b.provider.Name)
+		b.status.State = StateHalfOpen
+		return true
+	case StateHalfOpen:
+		// a completion is already checking whether the provider recovered
+		return false
+	}
+
+	return true
+}
+
+func (f *Fallback) succeed(b *breaker) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if b.status.State != StateClosed {
+		log.Infof("Provider %s recovered, circuit closed", b.provider.Name)
+	}
+
+	b.status.State = StateClosed
+	b.status.Failures = 0
+	b.status.LastSuccess = time.Now()
+}
+
+// abort a completion cancelled by the caller, it says nothing about the provider health
+func (f *Fallback) abort(b *breaker) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if b.status.State == StateHalfOpen {
+		b.status.State = StateOpen
+	}
+}
+
+func (f *Fallback) fail(b *breaker, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b.status.Failures++
+	b.status.LastError = err.Error()
+
+	if b.status.State == StateHalfOpen || b.status.Failures >= f.policy.FailureThreshold {
+		if b.status.State != StateOpen {
+			log.Warnf("Provider %s circuit open for %s after %d failures", b.provider.Name, f.policy.OpenInterval, b.status.Failures)
+		}
+
+		b.status.State = StateOpen
+		b.status.OpenedAt = time.Now()
+	}
+}
@@ -0,0 +1,142 @@
+package fallback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/llumus/lulis/internal/gpt"
+)
+
+// completer answers with its content, or with the next of its errors while there are some
+type completer struct {
+	content string
+	errs    []error
+	calls   int
+}
+
+func (c *completer) Complete(_ context.Context, _ gpt.Request) (gpt.Completion, error) {
+	c.calls++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		if err != nil {
+			return gpt.Completion{}, err
+		}
+	}
+
+	return gpt.Completion{Content: c.content}, nil
+}
+
+var errDown = &gpt.StatusError{StatusCode: http.StatusServiceUnavailable, Message: "down"}
+
+func TestCircuitBreaker(t *testing.T) {
+	primary, backup := &completer{content: "primary"}, &completer{content: "backup"}
+	f := NewFallback(Policy{FailureThreshold: 2, OpenInterval: time.Minute},
+		Provider{Name: "primary", Completer: primary},
+		Provider{Name: "backup", Completer: backup},
+	)
+
+	steps := []struct {
+		name string
+		// err of the primary provider, if called
+		err error
+		// elapsed moves the opening of the circuit back by the open interval
+		elapsed  bool
+		provider string
+		called   bool
+		state    State
+	}{
+		{"first failure", errDown, false, "backup", true, StateClosed},
+		{"threshold reached", errDown, false, "backup", true, StateOpen},
+		{"skipped while open", nil, false, "backup", false, StateOpen},
+		{"half open failure", errDown, true, "backup", true, StateOpen},
+		{"half open success", nil, true, "primary", true, StateClosed},
+		{"closed", nil, false, "primary", true, StateClosed},
+	}
+
+	for _, step := range steps {
+		if step.elapsed {
+			f.breakers[0].status.OpenedAt = f.breakers[0].status.OpenedAt.Add(-time.Minute)
+		}
+		primary.errs = []error{step.err}
+		calls := primary.calls
+
+		completion, err := f.Complete(context.Background(), gpt.Request{})
+		if err != nil {
+			t.Fatalf("%s: Complete() error = %v", step.name, err)
+		}
+
+		if completion.Provider != step.provider || completion.Content != step.provider {
+			t.Errorf("%s: served by %s with %q, want %s", step.name, completion.Provider, completion.Content, step.provider)
+		}
+		if called := primary.calls > calls; called != step.called {
+			t.Errorf("%s: primary called = %v, want %v", step.name, called, step.called)
+		}
+		if state := f.Status()["primary"].State; state != step.state {
+			t.Errorf("%s: primary circuit %s, want %s", step.name, state, step.state)
+		}
+	}
+}
+
+func TestHalfOpenSingleCompletion(t *testing.T) {
+	f := NewFallback(Policy{FailureThreshold: 1, OpenInterval: time.Minute}, Provider{Name: "primary", Completer: &completer{}})
+	f.breakers[0].status = ProviderStatus{State: StateOpen, OpenedAt: time.Now().Add(-time.Minute)}
+
+	if !f.allow(f.breakers[0]) {
+		t.Fatalf("allow() = false after the open interval, want a completion checking the provider")
+	}
+	if f.allow(f.breakers[0]) {
+		t.Errorf("allow() = true while half open, want a single completion at a time")
+	}
+
+	f.abort(f.breakers[0])
+	if state := f.Status()["primary"].State; state != StateOpen {
+		t.Errorf("circuit %s after a cancelled completion, want %s", state, StateOpen)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		errs  []error
+		calls int
+		err   bool
+	}{
+		{"success", nil, 1, false},
+		{"retried", []error{errDown, errDown}, 3, false},
+		{"retries exhausted", []error{errDown, errDown, errDown}, 3, true},
+		{"not retryable", []error{&gpt.StatusError{StatusCode: http.StatusBadRequest, Message: "bad"}}, 1, true},
+		{"not a status error", []error{errors.New("broken")}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &completer{content: "ok", errs: tt.errs}
+			f := NewFallback(Policy{Retries: 2, InitialBackoff: time.Millisecond, FailureThreshold: 3, OpenInterval: time.Minute},
+				Provider{Name: "only", Completer: c})
+
+			_, err := f.Complete(context.Background(), gpt.Request{})
+			if (err != nil) != tt.err {
+				t.Errorf("Complete() error = %v, want an error %v", err, tt.err)
+			}
+			if c.calls != tt.calls {
+				t.Errorf("calls = %d, want %d", c.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestAllCircuitsOpen(t *testing.T) {
+	f := NewFallback(Policy{FailureThreshold: 1, OpenInterval: time.Minute}, Provider{Name: "primary", Completer: &completer{errs: []error{errDown}}})
+
+	if _, err := f.Complete(context.Background(), gpt.Request{}); !errors.Is(err, errDown) {
+		t.Fatalf("Complete() error = %v, want %v", err, errDown)
+	}
+
+	if _, err := f.Complete(context.Background(), gpt.Request{}); err == nil {
+		t.Errorf("Complete() with every circuit open, want an error")
+	}
+}
@@ -1,8 +1,32 @@
 package gpt
 
-import "context"
+import (
+	"context"
+
+	"github.com/llumus/lulis/internal/conversation"
+	"github.com/llumus/lulis/internal/persona"
+)
+
+// DialogueLine is a line of a scripted dialogue and the persona speaking it
+type DialogueLine struct {
+	Persona string `json:"persona"`
+	Text    string `json:"text"`
+}
 
 type GPT interface {
 	GenerateResponse(ctx context.Context, question string) (string, error)
+	// StreamResponse calls onSentence with every sentence of the answer as soon as it is generated, and returns
+	// the whole answer
+	StreamResponse(ctx context.Context, question string, onSentence func(sentence string)) (string, error)
 	GenerateQuestion(ctx context.Context) (string, error)
+	GenerateDialogue(ctx context.Context, topic string, personas []*persona.Persona, turns int) ([]DialogueLine, error)
+	conversation.Summarizer
+}
+
+type servedKey struct{}
+
+// NewServedContext calls served with the provider of every completion made with the context, e.g. to show the
+// failovers of a job
+func NewServedContext(ctx context.Context, served func(provider string)) context.Context {
+	return context.WithValue(ctx, servedKey{}, served)
 }
@@ -0,0 +1,85 @@
+package gpt
+
+import (
+	"context"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/llumus/lulis/internal/persona"
+)
+
+// Vars of the persona prompt templates, e.g. "Good {{.TimeOfDay}} {{.Viewer}}"
+type Vars struct {
+	Persona string
+	// Viewer who asked, empty for the automatic questions
+	Viewer string
+	// Topic the stream is talking about
+	Topic string
+	// Uptime of the stream
+	Uptime time.Duration
+	Now    time.Time
+}
+
+// TimeOfDay is morning, afternoon, evening or night
+func (v Vars) TimeOfDay() string {
+	switch hour := v.Now.Hour(); {
+	case hour >= 5 && hour < 12:
+		return "morning"
+	case hour >= 12 && hour < 18:
+		return "afternoon"
+	case hour >= 18 && hour < 23:
+		return "evening"
+	default:
+		return "night"
+	}
+}
+
+type varsKey struct{}
+
+// NewVarsContext carries the variables of the prompt templates
+func NewVarsContext(ctx context.Context, v Vars) context.Context {
+	return context.WithValue(ctx, varsKey{}, v)
+}
+
+func VarsFromContext(ctx context.Context) (Vars, bool) {
+	v, ok := ctx.Value(varsKey{}).(Vars)
+	return v, ok
+}
+
+// render the prompt templates of the persona with the variables of the context, on a copy of the persona
+func render(ctx context.Context, p *persona.Persona) *persona.Persona {
+	v, _ := VarsFromContext(ctx)
+	v.Persona = p.Name
+	if v.Now.IsZero() {
+		v.Now = time.Now()
+	}
+
+	c := *p
+	c.SystemPrompt = execute("system_prompt", p.SystemPrompt, v)
+	c.Description = execute("description", p.Description, v)
+	c.QuestionPrompt = execute("question_prompt", p.QuestionPrompt, v)
+	c.QuestionRequest = execute("question_request", p.QuestionRequest, v)
+	return &c
+}
+
+// execute the template, a broken one is used as it is
+func execute(name, text string, v Vars) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		log.Errorf("Error parsing the %s template: %v", name, err)
+		return text
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, v); err != nil {
+		log.Errorf("Error rendering the %s template: %v", name, err)
+		return text
+	}
+
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/llumus/lulis/internal/interstitial"
+	"github.com/llumus/lulis/internal/job"
+	"github.com/llumus/lulis/internal/media"
+)
+
+const (
+	width    = 1280
+	height   = 720
+	duration = 4
+	// slots is the number of rotating output files, so a card is never overwritten while the stream reads it
+	slots = 4
+)
+
+var stageLabels = map[job.Status]string{
+	job.StatusGeneratingAnswer: "Answer",
+	job.StatusGeneratingAudio:  "Voice",
+	job.StatusGeneratingVideo:  "Video",
+}
+
+// Renderer renders the title card as a short silent video to be used as the stream idle loop
+type Renderer struct {
+	dir      string
+	fontPath string
+
+	mu   sync.Mutex
+	slot int
+}
+
+// NewRenderer dir must be the folder of the stream playlist
+func NewRenderer(dir string, fontPath string) *Renderer {
+	return &Renderer{
+		dir:      dir,
+		fontPath: fontPath,
+	}
+}
+
+func (r *Renderer) Render(ctx context.Context, card interstitial.Card) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.slot = (r.slot + 1) % slots
+	var (
+		name         = "interstitial_" + strconv.Itoa(r.slot)
+		questionPath = filepath.Join(r.dir, name+".txt")
+		outputPath   = filepath.Join(r.dir, name+".mp4")
+	)
+
+	if err := os.WriteFile(questionPath, []byte(media.WrapText(card.Question, 40)), 0644); err != nil {
+		return "", err
+	}
+	defer os.Remove(questionPath)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y",
+		"-f", "lavfi", "-i", fmt.Sprintf("color=c=0x101820:s=%dx%d:r=25:d=%d", width, height, duration),
+		"-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo",
+		"-vf", r.filter(card, questionPath),
+		"-t", strconv.Itoa(duration),
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		outputPath,
+	)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return "", fmt.Errorf("error rendering interstitial: %w: %s", err, lines[len(lines)-1])
+	}
+
+	return outputPath, nil
+}
+
+func (r *Renderer) filter(card interstitial.Card, questionPath string) string {
+	filters := []string{
+		r.text("'Coming up next'", 52, "(w-text_w)/2", "70", "0xf1c40f"),
+		r.textFile(questionPath, 40, "(w-text_w)/2", "(h-text_h)/2-60"),
+	}
+
+	if card.User != "" {
+		filters = append(filters, r.text("'asked by "+escape(card.User)+"'", 30, "(w-text_w)/2", "h/2+90", "0xbbbbbb"))
+	}
+
+	var (
+		boxWidth = 320
+		gap      = 40
+		left     = (width - len(interstitial.Stages)*boxWidth - (len(interstitial.Stages)-1)*gap) / 2
+		current  = stageIndex(card.Status)
+	)
+
+	for i, stage := range interstitial.Stages {
+		color := "0x444444"
+		switch {
+		case i < current:
+			color = "0x2ecc71"
+		case i == current:
+			color = "0xf1c40f"
+		}
+
+		x := left + i*(boxWidth+gap)
+		filters = append(filters,
+			fmt.Sprintf("drawbox=x=%d:y=580:w=%d:h=16:color=%s:t=fill", x, boxWidth, color),
+			r.text("'"+stageLabels[stage]+"'", 26, strconv.Itoa(x)+"+("+strconv.Itoa(boxWidth)+"-text_w)/2", "615", "white"),
+		)
+	}
+
+	if card.Pending > 1 {
+		filters = append(filters, r.text("'+"+strconv.Itoa(card.Pending-1)+" more in the queue'", 24, "w-text_w-30", "h-40", "0x888888"))
+	}
+
+	return strings.Join(filters, ",")
+}
+
+func (r *Renderer) text(text string, size int, x, y, color string) string {
+	return fmt.Sprintf("drawtext=text=%s%s:fontsize=%d:fontcolor=%s:x=%s:y=%s", text, r.font(), size, color, x, y)
+}
+
+func (r *Renderer) textFile(path string, size int, x, y string) string {
+	return fmt.Sprintf("drawtext=textfile='%s'%s:fontsize=%d:fontcolor=white:line_spacing=12:x=%s:y=%s", path, r.font(), size, x, y)
+}
+
+func (r *Renderer) font() string {
+	if r.fontPath == "" {
+		return ""
+	}
+
+	return ":fontfile='" + r.fontPath + "'"
+}
+
+// stageIndex position of the status in the progress indicator, queued jobs have no stage done yet
+func stageIndex(status job.Status) int {
+	for i, stage := range interstitial.Stages {
+		if stage == status {
+			return i
+		}
+	}
+
+	if status == job.StatusReady {
+		return len(interstitial.Stages)
+	}
+
+	return -1
+}
+
+// escape the characters with a special meaning inside a quoted drawtext text
+func escape(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `'\''`, `:`, `\:`, `%`, `\%`)
+	return replacer.Replace(text)
+}
@@ -0,0 +1,26 @@
+package interstitial
+
+import (
+	"context"
+
+	"github.com/llumus/lulis/internal/job"
+)
+
+// Stages shown in the progress indicator, in pipeline order
+var Stages = []job.Status{
+	job.StatusGeneratingAnswer,
+	job.StatusGeneratingAudio,
+	job.StatusGeneratingVideo,
+}
+
+// Card is the "coming up next" title card for a pending job
+type Card struct {
+	Question string
+	User     string
+	Status   job.Status
+	Pending  int
+}
+
+type Renderer interface {
+	Render(ctx context.Context, card Card) (string, error)
+}
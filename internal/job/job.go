@@ -0,0 +1,255 @@
+package job
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type Status string
+
+const (
+	StatusQueued           Status = "queued"
+	StatusGeneratingAnswer Status = "generating_answer"
+	StatusGeneratingAudio  Status = "generating_audio"
+	StatusGeneratingVideo  Status = "generating_video"
+	StatusReady            Status = "ready"
+	StatusFailed           Status = "failed"
+)
+
+type Kind string
+
+const (
+	KindQuestion Kind = "question"
+	// KindDialogue jobs have the topic as question and the speaking personas
+	KindDialogue Kind = "dialogue"
+)
+
+// maxFinishedJobs is the number of ready or failed jobs kept around for lookups
+const maxFinishedJobs = 128
+
+var log = logrus.New()
+
+// Job is a question going through the generation pipeline
+type Job struct {
+	ID       string   `json:"id"`
+	Kind     Kind     `json:"kind"`
+	Question string   `json:"question"`
+	User     string   `json:"user,omitempty"`
+	Persona  string   `json:"persona"`
+	Personas []string `json:"personas,omitempty"`
+	Status   Status   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	// Metadata recorded by the pipeline stages, e.g. the sources of the answer
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Message is the question in the format expected by the GPT prompts
+func (j Job) Message() string {
+	if j.User == "" {
+		return j.Question
+	}
+
+	return j.Question + " - " + j.User
+}
+
+// snapshot copies the job with its own metadata, the tracker keeps changing the original
+func (j *Job) snapshot() Job {
+	c := *j
+	if j.Metadata != nil {
+		c.Metadata = make(map[string]string, len(j.Metadata))
+		for key, value := range j.Metadata {
+			c.Metadata[key] = value
+		}
+	}
+
+	return c
+}
+
+// Done when the job is ready or failed
+func (j Job) Done() bool {
+	return j.Status == StatusReady || j.Status == StatusFailed
+}
+
+// Event is emitted every time a job changes status
+type Event struct {
+	Job  Job       `json:"job"`
+	Time time.Time `json:"time"`
+}
+
+// Tracker keeps the jobs and notifies subscribers of status changes
+type Tracker struct {
+	mu          sync.Mutex
+	jobs        map[string]*Job
+	finished    []string
+	subscribers []chan Event
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		jobs: make(map[string]*Job),
+	}
+}
+
+// Create a queued job for the question addressed to the persona
+func (t *Tracker) Create(question, user, persona string) Job {
+	return t.add(&Job{
+		Kind:     KindQuestion,
+		Question: question,
+		User:     user,
+		Persona:  persona,
+	})
+}
+
+// CreateDialogue a queued dialogue job between the personas about the topic
+func (t *Tracker) CreateDialogue(topic, user string, personas []string) Job {
+	return t.add(&Job{
+		Kind:     KindDialogue,
+		Question: topic,
+		User:     user,
+		Personas: personas,
+	})
+}
+
+func (t *Tracker) add(j *Job) Job {
+	now := time.Now()
+	j.ID = uuid.NewString()
+	j.Status = StatusQueued
+	j.CreatedAt = now
+	j.UpdatedAt = now
+
+	t.mu.Lock()
+	t.jobs[j.ID] = j
+	event := Event{Job: j.snapshot(), Time: now}
+	t.mu.Unlock()
+
+	t.publish(event)
+	return *j
+}
+
+func (t *Tracker) Get(id string) (Job, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j, ok := t.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return j.snapshot(), true
+}
+
+// SetMetadata records a value on the job, without notifying the subscribers
+func (t *Tracker) SetMetadata(id, key, value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j, ok := t.jobs[id]
+	if !ok {
+		return
+	}
+
+	if j.Metadata == nil {
+		j.Metadata = make(map[string]string)
+	}
+	j.Metadata[key] = value
+}
+
+// Update the status of a job, err is recorded for failed jobs
+func (t *Tracker) Update(id string, status Status, err error) {
+	t.mu.Lock()
+	j, ok := t.jobs[id]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+
+	wasDone := j.Done()
+	j.Status = status
+	j.UpdatedAt = time.Now()
+	if err != nil {
+		j.Error = err.Error()
+	}
+
+	if j.Done() && !wasDone {
+		t.finish(j.ID)
+	}
+
+	event := Event{Job: j.snapshot(), Time: j.UpdatedAt}
+	t.mu.Unlock()
+
+	t.publish(event)
+}
+
+// Pending jobs, oldest first
+func (t *Tracker) Pending() []Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := make([]Job, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		if !j.Done() {
+			pending = append(pending, j.snapshot())
+		}
+	}
+
+	sort.Slice(pending, func(a, b int) bool {
+		return pending[a].CreatedAt.Before(pending[b].CreatedAt)
+	})
+
+	return pending
+}
+
+// List the pending and the latest finished jobs, newest first
+func (t *Tracker) List() []Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jobs := make([]Job, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		jobs = append(jobs, j.snapshot())
+	}
+
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].CreatedAt.After(jobs[b].CreatedAt)
+	})
+
+	return jobs
+}
+
+// Subscribe to the job events, slow subscribers miss events instead of blocking the pipeline
+func (t *Tracker) Subscribe() <-chan Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch := make(chan Event, 32)
+	t.subscribers = append(t.subscribers, ch)
+	return ch
+}
+
+func (t *Tracker) publish(event Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, ch := range t.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Warnf("Dropping event %s for job %s, subscriber is full", event.Job.Status, event.Job.ID)
+		}
+	}
+}
+
+// finish keeps only the latest finished jobs, must be called with the lock held
+func (t *Tracker) finish(id string) {
+	t.finished = append(t.finished, id)
+	if len(t.finished) > maxFinishedJobs {
+		delete(t.jobs, t.finished[0])
+		t.finished = t.finished[1:]
+	}
+}
@@ -0,0 +1,252 @@
+package bm25
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/knowledge"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+const (
+	k1 = 1.2
+	b  = 0.75
+	// passageWords is the size of the passages the documents are split in, paragraphs are kept whole when possible
+	passageWords = 80
+	// relativeScore drops the passages scoring less than this part of the best one
+	relativeScore = 0.5
+)
+
+type passage struct {
+	source string
+	text   string
+	terms  map[string]int
+	length int
+	// persona is the folder of the document, empty for the documents of every persona
+	persona string
+}
+
+// Index is a BM25 index of the markdown and text files of a folder, the files of a sub folder named after a
+// persona are only for that persona. The index is rebuilt when the files change
+type Index struct {
+	dir      string
+	minScore float64
+
+	mu        sync.RWMutex
+	passages  []passage
+	documents map[string]int
+	avgLength float64
+	version   string
+}
+
+// NewIndex minScore is the BM25 score a passage needs to be relevant at all
+func NewIndex(dir string, minScore float64) (*Index, error) {
+	i := &Index{dir: dir, minScore: minScore}
+	if err := i.reload(); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (i *Index) Retrieve(_ context.Context, persona string, question string, limit int) ([]knowledge.Passage, error) {
+	terms := knowledge.Terms(question)
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var results []knowledge.Passage
+	for _, p := range i.passages {
+		if p.persona != "" && !strings.EqualFold(p.persona, persona) {
+			continue
+		}
+
+		if score := i.score(p, terms); score >= i.minScore {
+			results = append(results, knowledge.Passage{Source: p.source, Text: p.text, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Score > results[b].Score
+	})
+
+	for n, result := range results {
+		if n >= limit || result.Score < results[0].Score*relativeScore {
+			results = results[:n]
+			break
+		}
+	}
+
+	return results, nil
+}
+
+func (i *Index) score(p passage, terms []string) float64 {
+	var (
+		score float64
+		total = float64(len(i.passages))
+	)
+
+	for _, term := range terms {
+		frequency := float64(p.terms[term])
+		if frequency == 0 {
+			continue
+		}
+
+		documents := float64(i.documents[term])
+		idf := math.Log(1 + (total-documents+0.5)/(documents+0.5))
+		score += idf * frequency * (k1 + 1) / (frequency + k1*(1-b+b*float64(p.length)/i.avgLength))
+	}
+
+	return score
+}
+
+// Watch to rebuild the index when the files change until the context is done
+func (i *Index) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.reload(); err != nil {
+				log.Errorf("Error reloading knowledge base %s: %v", i.dir, err)
+			}
+		}
+	}
+}
+
+func (i *Index) reload() error {
+	files, version, err := i.files()
+	if err != nil {
+		return err
+	}
+
+	i.mu.RLock()
+	unchanged := version == i.version
+	i.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	var (
+		passages  []passage
+		documents = make(map[string]int)
+		lengths   int
+	)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		source, _ := filepath.Rel(i.dir, file)
+		var persona string
+		if dir := filepath.Dir(source); dir != "." {
+			persona = strings.Split(filepath.ToSlash(dir), "/")[0]
+		}
+
+		for _, chunk := range split(string(data)) {
+			p := passage{source: filepath.ToSlash(source), text: chunk, terms: make(map[string]int), persona: persona}
+			for _, term := range knowledge.Terms(chunk) {
+				p.terms[term]++
+				p.length++
+			}
+
+			for term := range p.terms {
+				documents[term]++
+			}
+
+			lengths += p.length
+			passages = append(passages, p)
+		}
+	}
+
+	i.mu.Lock()
+	i.passages = passages
+	i.documents = documents
+	i.avgLength = 1
+	if len(passages) > 0 {
+		i.avgLength = float64(lengths) / float64(len(passages))
+	}
+	i.version = version
+	i.mu.Unlock()
+
+	log.Infof("Indexed %d passages of %d documents from %s", len(passages), len(files), i.dir)
+	return nil
+}
+
+// files lists the markdown and text files, the version changes when any file is added, removed or modified
+func (i *Index) files() ([]string, string, error) {
+	var (
+		files   []string
+		version strings.Builder
+	)
+
+	err := filepath.WalkDir(i.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || (ext != ".md" && ext != ".txt") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, path)
+		_, _ = fmt.Fprintf(&version, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+
+	return files, version.String(), err
+}
+
+// split the document in passages of whole paragraphs up to passageWords, longer paragraphs are passages alone
+func split(document string) []string {
+	var (
+		passages []string
+		current  []string
+		words    int
+	)
+
+	flush := func() {
+		if len(current) > 0 {
+			passages = append(passages, strings.Join(current, "\n\n"))
+		}
+		current, words = nil, 0
+	}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		count := len(strings.Fields(paragraph))
+		if words > 0 && words+count > passageWords {
+			flush()
+		}
+
+		current = append(current, paragraph)
+		words += count
+	}
+
+	flush()
+	return passages
+}
@@ -0,0 +1,96 @@
+package bm25
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// knowledgeBase writes the files, by path relative to the folder, and indexes them
+func knowledgeBase(t *testing.T, files map[string]string) *Index {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("error creating %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", path, err)
+		}
+	}
+
+	i, err := NewIndex(dir, 0.1)
+	if err != nil {
+		t.Fatalf("NewIndex() error = %v", err)
+	}
+
+	return i
+}
+
+func TestRetrieve(t *testing.T) {
+	i := knowledgeBase(t, map[string]string{
+		"brazil.md":      "Brasilia is the capital of Brazil.\n\nThe Amazon rainforest covers most of the north of Brazil.",
+		"football.txt":   "Brazil won the football world cup five times, more than any other country.",
+		"notes.json":     "Brasilia capital capital capital",
+		"lula/career.md": "Lula was a metalworker and a union leader before being elected president.",
+		"other/plans.md": "The president plans a new capital.",
+	})
+
+	tests := []struct {
+		name     string
+		persona  string
+		question string
+		limit    int
+		sources  []string
+	}{
+		{"best passage", "lula", "What is the capital of Brazil?", 3, []string{"brazil.md"}},
+		{"persona folder", "Lula", "Was he a union leader?", 3, []string{"lula/career.md"}},
+		{"folder of another persona", "bolsonaro", "Was he a union leader?", 3, nil},
+		{"nothing relevant", "lula", "Chocolate cake recipe", 3, nil},
+		{"limit", "lula", "Brazil", 1, []string{"brazil.md"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passages, err := i.Retrieve(context.Background(), tt.persona, tt.question, tt.limit)
+			if err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+
+			var sources []string
+			for _, p := range passages {
+				sources = append(sources, p.Source)
+			}
+
+			if strings.Join(sources, ",") != strings.Join(tt.sources, ",") {
+				t.Errorf("Retrieve() sources = %v, want %v", sources, tt.sources)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	long := strings.Repeat("word ", passageWords+10)
+
+	tests := []struct {
+		name     string
+		document string
+		want     int
+	}{
+		{"short paragraphs together", "First paragraph.\n\nSecond paragraph.", 1},
+		{"long paragraph alone", "Intro.\r\n\r\n" + long + "\n\nOutro.", 3},
+		{"empty", "\n\n  \n\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := split(tt.document); len(got) != tt.want {
+				t.Errorf("split() = %d passages %q, want %d", len(got), got, tt.want)
+			}
+		})
+	}
+}
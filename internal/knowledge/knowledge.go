@@ -0,0 +1,57 @@
+package knowledge
+
+import (
+	"context"
+
+	"github.com/llumus/lulis/internal/text"
+)
+
+// Passage is a piece of a document of the knowledge base
+type Passage struct {
+	Source string  `json:"source"`
+	Text   string  `json:"text"`
+	Score  float64 `json:"score"`
+}
+
+// Retriever finds the passages relevant to a question for the persona, the most relevant first
+type Retriever interface {
+	Retrieve(ctx context.Context, persona string, question string, limit int) ([]Passage, error)
+}
+
+type contextKey struct{}
+
+// NewContext carries the passages retrieved for the question to the prompts
+func NewContext(ctx context.Context, passages []Passage) context.Context {
+	return context.WithValue(ctx, contextKey{}, passages)
+}
+
+func FromContext(ctx context.Context) ([]Passage, bool) {
+	passages, ok := ctx.Value(contextKey{}).([]Passage)
+	return passages, ok && len(passages) > 0
+}
+
+// Sources of the passages, once each, in order
+func Sources(passages []Passage) []string {
+	var sources []string
+	seen := make(map[string]bool)
+	for _, p := range passages {
+		if !seen[p.Source] {
+			seen[p.Source] = true
+			sources = append(sources, p.Source)
+		}
+	}
+
+	return sources
+}
+
+// Terms of a text for the search, folded words of at least 2 characters
+func Terms(s string) []string {
+	var terms []string
+	for _, word := range text.Words(s) {
+		if len([]rune(word)) >= 2 {
+			terms = append(terms, word)
+		}
+	}
+
+	return terms
+}
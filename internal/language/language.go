@@ -0,0 +1,137 @@
+package language
+
+import (
+	"context"
+	"strings"
+
+	"github.com/llumus/lulis/internal/text"
+)
+
+// stopWords of each language, folded, the words shared by several languages count less
+var stopWords = map[string][]string{
+	"pt": {
+		"voce", "voces", "nao", "sim", "que", "com", "para", "pra", "uma", "um", "isso", "esse", "essa", "ele", "ela",
+		"eles", "muito", "tambem", "mais", "mas", "como", "qual", "quais", "quando", "onde", "porque", "por", "sobre",
+		"seu", "sua", "meu", "minha", "tem", "tudo", "fala", "acha", "pode", "vai", "obrigado", "bom", "dia", "sao",
+		"ao", "dos", "das", "nos", "na", "no", "foi", "ja", "ainda", "agora", "entao", "gente",
+	},
+	"es": {
+		"usted", "tu", "que", "con", "para", "una", "uno", "eso", "este", "esta", "el", "los", "las", "del", "muy",
+		"tambien", "mas", "pero", "como", "cual", "cuando", "donde", "porque", "por", "sobre", "su", "mi", "tiene",
+		"todo", "puede", "va", "gracias", "bueno", "hola", "es", "son", "fue", "ya", "todavia", "ahora", "entonces",
+		"hay", "yo", "piensas", "opinas", "dime", "eres", "estas",
+	},
+	"en": {
+		"you", "your", "the", "and", "what", "is", "are", "was", "do", "does", "did", "with", "for", "about",
+		"this", "that", "it", "of", "to", "in", "on", "how", "why", "when", "where", "who", "which", "can", "will",
+		"would", "think", "have", "has", "my", "me", "we", "they", "not", "yes", "no", "thanks", "hello", "favorite",
+	},
+	"fr": {
+		"vous", "tu", "que", "qui", "avec", "pour", "une", "un", "le", "la", "les", "des", "du", "est", "sont", "tres",
+		"aussi", "plus", "mais", "comment", "quel", "quelle", "quand", "ou", "pourquoi", "sur", "votre", "ton", "mon",
+		"pense", "penses", "merci", "bonjour", "oui", "non", "je", "il", "elle", "nous", "ce", "cette",
+	},
+	"it": {
+		"tu", "lei", "che", "con", "per", "una", "uno", "il", "lo", "gli", "della", "del", "sono", "molto", "anche",
+		"piu", "ma", "come", "quale", "quando", "dove", "perche", "sul", "tuo", "tua", "mio", "pensi", "grazie",
+		"ciao", "si", "non", "io", "noi", "questo", "questa", "cosa",
+	},
+	"de": {
+		"du", "sie", "der", "die", "das", "und", "ist", "sind", "mit", "fur", "ein", "eine", "nicht", "auch", "aber",
+		"wie", "was", "wann", "wo", "warum", "uber", "dein", "deine", "mein", "ich", "wir", "denkst", "danke", "hallo",
+		"ja", "nein", "hast", "bist",
+	},
+}
+
+// marks are letters that only some of the languages use
+var marks = map[rune][]string{
+	'ã': {"pt"}, 'õ': {"pt"}, 'ç': {"pt", "fr"}, 'ê': {"pt", "fr"},
+	'ñ': {"es"}, '¿': {"es"}, '¡': {"es"},
+	'ß': {"de"}, 'ä': {"de"}, 'ö': {"de"}, 'ü': {"de"},
+	'è': {"fr", "it"}, 'à': {"fr", "it", "pt"},
+}
+
+// names of the languages, for the prompts
+var names = map[string]string{
+	"pt": "Portuguese",
+	"es": "Spanish",
+	"en": "English",
+	"fr": "French",
+	"it": "Italian",
+	"de": "German",
+}
+
+var index = func() map[string][]string {
+	index := make(map[string][]string)
+	for language, words := range stopWords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// Detect the language of a chat message, its ISO 639-1 code or empty when the message is too short or ambiguous
+func Detect(s string) string {
+	scores := make(map[string]float64)
+	for _, word := range text.Words(s) {
+		languages := index[word]
+		for _, language := range languages {
+			scores[language] += 1 / float64(len(languages))
+		}
+	}
+
+	for _, r := range strings.ToLower(s) {
+		for _, language := range marks[r] {
+			scores[language] += 0.5
+		}
+	}
+
+	var (
+		best          string
+		first, second float64
+	)
+
+	for language, score := range scores {
+		switch {
+		case score > first:
+			best, first, second = language, score, first
+		case score > second:
+			second = score
+		}
+	}
+
+	if first < 1 || first-second < 0.5 {
+		return ""
+	}
+
+	return best
+}
+
+// Base of a language tag, "pt" for "pt-BR"
+func Base(tag string) string {
+	base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+	base, _, _ = strings.Cut(base, "_")
+	return base
+}
+
+// Name of the language in English, the tag itself when unknown
+func Name(tag string) string {
+	if name, ok := names[Base(tag)]; ok {
+		return name
+	}
+
+	return tag
+}
+
+type contextKey struct{}
+
+// NewContext carries the language of the answer
+func NewContext(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, contextKey{}, language)
+}
+
+func FromContext(ctx context.Context) (string, bool) {
+	language, ok := ctx.Value(contextKey{}).(string)
+	return language, ok && language != ""
+}
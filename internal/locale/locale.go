@@ -0,0 +1,152 @@
+package locale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/language"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// Catalog of the chat strings by language, one <language>.json file of key to string per language in a folder,
+// reloaded when the files change. The strings missing in a language are the ones of the fallback language, then
+// the defaults
+type Catalog struct {
+	dir      string
+	fallback string
+	defaults map[string]string
+
+	mu        sync.RWMutex
+	languages map[string]map[string]string
+	version   string
+}
+
+// NewCatalog of the folder, a missing folder leaves only the defaults
+func NewCatalog(dir string, fallback string, defaults map[string]string) (*Catalog, error) {
+	c := &Catalog{
+		dir:       dir,
+		fallback:  strings.ToLower(fallback),
+		defaults:  defaults,
+		languages: make(map[string]map[string]string),
+	}
+
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Text of the key in the language, the fallback language when it is empty, and "{name}" replaced by the value
+// following the name in pairs
+func (c *Catalog) Text(lang string, key string, pairs ...string) string {
+	c.mu.RLock()
+	text, ok := c.lookup(lang, key)
+	c.mu.RUnlock()
+
+	if !ok {
+		log.Warnf("No text for %s", key)
+		text = key
+	}
+
+	if len(pairs) == 0 {
+		return text
+	}
+
+	replacements := make([]string, 0, len(pairs))
+	for i := 0; i+1 < len(pairs); i += 2 {
+		replacements = append(replacements, "{"+pairs[i]+"}", pairs[i+1])
+	}
+
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// lookup the key in the language, then its base language, the fallback language and the defaults, must be called
+// with the lock held
+func (c *Catalog) lookup(lang string, key string) (string, bool) {
+	lang = strings.ToLower(lang)
+	for _, l := range []string{lang, language.Base(lang), c.fallback, language.Base(c.fallback)} {
+		if text, ok := c.languages[l][key]; ok && l != "" {
+			return text, true
+		}
+	}
+
+	text, ok := c.defaults[key]
+	return text, ok
+}
+
+// Watch to reload the files when they change until the context is done, broken files keep the previous strings
+func (c *Catalog) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.reload(); err != nil {
+				log.Errorf("Error reloading the locales %s: %v", c.dir, err)
+			}
+		}
+	}
+}
+
+func (c *Catalog) reload() error {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	// the files and their modification times, a file added, removed or changed reloads them all
+	var version strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(&version, "%s@%d;", path, info.ModTime().UnixNano())
+	}
+
+	c.mu.RLock()
+	unchanged := version.String() == c.version
+	c.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	languages := make(map[string]map[string]string, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var texts map[string]string
+		if err := json.Unmarshal(data, &texts); err != nil {
+			return fmt.Errorf("error parsing locale %s: %w", path, err)
+		}
+
+		languages[strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".json"))] = texts
+	}
+
+	c.mu.Lock()
+	c.languages = languages
+	c.version = version.String()
+	c.mu.Unlock()
+
+	log.Infof("Loaded %d locales from %s", len(languages), c.dir)
+	return nil
+}
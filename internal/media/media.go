@@ -0,0 +1,60 @@
+package media
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// FFProbeOutput is the part of the ffprobe json output read by the ffmpeg packages
+type FFProbeOutput struct {
+	Format Format `json:"format"`
+}
+
+type Format struct {
+	Duration string `json:"duration"`
+}
+
+// Duration of the video in seconds, read with ffprobe
+func Duration(path string) (float64, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-show_format", "-of", "json", path)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, err
+	}
+
+	var probeOutput FFProbeOutput
+	if err := json.Unmarshal(output, &probeOutput); err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(probeOutput.Format.Duration, 64)
+}
+
+// WrapText breaks the text in lines of at most size characters without breaking words, for the drawtext files
+func WrapText(text string, size int) string {
+	var (
+		lines []string
+		line  string
+	)
+
+	for _, word := range strings.Fields(text) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > size {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,104 @@
+package ffmpeg
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/llumus/lulis/internal/persona"
+)
+
+// Mixer puts the audio over a still frame of the face video, an audio-only clip without the cost of the lip sync
+type Mixer struct {
+	dir          string
+	baseUrl      string
+	faceVideoUrl string
+	// imagePath replaces the frame of the face video when set
+	imagePath string
+	slots     int
+
+	mu   sync.Mutex
+	slot int
+}
+
+// NewMixer the clips rotate over slots files in dir, as the downloaded lip sync videos do
+func NewMixer(dir string, baseUrl string, faceVideoUrl string, imagePath string, slots int) *Mixer {
+	return &Mixer{
+		dir:          dir,
+		baseUrl:      baseUrl,
+		faceVideoUrl: faceVideoUrl,
+		imagePath:    imagePath,
+		slots:        slots,
+	}
+}
+
+func (m *Mixer) GenerateLipSyncVideo(ctx context.Context, fsKey string) (string, error) {
+	faceVideoUrl := m.faceVideoUrl
+	if p, ok := persona.FromContext(ctx); ok && p.FaceVideoURL != "" {
+		faceVideoUrl = p.FaceVideoURL
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	imagePath, err := m.image(ctx, faceVideoUrl)
+	if err != nil {
+		return "", err
+	}
+
+	m.slot = (m.slot + 1) % m.slots
+	outputPath := filepath.Join(m.dir, "still"+strconv.Itoa(m.slot)+".mp4")
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y",
+		"-loop", "1",
+		"-framerate", "25",
+		"-i", imagePath,
+		"-i", m.baseUrl+fsKey,
+		"-shortest",
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-tune", "stillimage",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		outputPath,
+	)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("error rendering the still clip: %w: %s", err, output)
+	}
+
+	return outputPath, nil
+}
+
+// image is the still of the clip, the first frame of the face video is extracted once, must be called with the
+// lock held
+func (m *Mixer) image(ctx context.Context, faceVideoUrl string) (string, error) {
+	if m.imagePath != "" {
+		return m.imagePath, nil
+	}
+
+	hash := sha1.Sum([]byte(faceVideoUrl))
+	framePath := filepath.Join(m.dir, "still_"+hex.EncodeToString(hash[:8])+".png")
+	if _, err := os.Stat(framePath); err == nil {
+		return framePath, nil
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y",
+		"-i", faceVideoUrl,
+		"-frames:v", "1",
+		framePath,
+	)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("error extracting the face frame of %s: %w: %s", faceVideoUrl, err, output)
+	}
+
+	return framePath, nil
+}
@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/llumus/lulis/internal/cost"
 	"github.com/llumus/lulis/internal/fs"
+	"github.com/llumus/lulis/internal/persona"
 	"github.com/sirupsen/logrus"
 )
 
@@ -29,10 +31,16 @@ type Payload struct {
 }
 
 type Response struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
-	Error  string `json:"error"`
-	Output string `json:"output,omitempty"`
+	ID      string  `json:"id"`
+	Status  string  `json:"status"`
+	Error   string  `json:"error"`
+	Output  string  `json:"output,omitempty"`
+	Metrics Metrics `json:"metrics"`
+}
+
+// Metrics of a prediction, Replicate bills its predict time
+type Metrics struct {
+	PredictTime float64 `json:"predict_time"`
 }
 
 type Mixer struct {
@@ -53,12 +61,17 @@ func NewMixer(apiKey string, baseUrl string, finalVideoUrl string, client *http.
 	}
 }
 
-func (m *Mixer) GenerateLipSyncVideo(_ context.Context, fsKey string) (string, error) {
+func (m *Mixer) GenerateLipSyncVideo(ctx context.Context, fsKey string) (string, error) {
+	faceVideoUrl := m.finalVideoUrl
+	if p, ok := persona.FromContext(ctx); ok && p.FaceVideoURL != "" {
+		faceVideoUrl = p.FaceVideoURL
+	}
+
 	body, err := json.Marshal(&Payload{
 		Version: version,
 		Input: map[string]interface{}{
 			"fps":           25,
-			"face":          m.finalVideoUrl,
+			"face":          faceVideoUrl,
 			"pads":          "0 10 0 0",
 			"audio":         m.baseUrl + fsKey,
 			"smooth":        true,
@@ -100,18 +113,19 @@ func (m *Mixer) GenerateLipSyncVideo(_ context.Context, fsKey string) (string, e
 	}
 
 	if result.ID != "" {
-		generatedVideoUrl, err := m.waitJobCompleteOrFail(result.ID)
+		prediction, err := m.waitJobCompleteOrFail(result.ID)
 		if err != nil {
 			return "", err
 		}
 
-		return m.fs.DownloadVideoUrl(generatedVideoUrl)
+		cost.Record(ctx, "replicate", version, cost.UnitSeconds, prediction.Metrics.PredictTime)
+		return m.fs.DownloadVideoUrl(prediction.Output)
 	}
 
 	return "", nil
 }
 
-func (m *Mixer) waitJobCompleteOrFail(jobID string) (string, error) {
+func (m *Mixer) waitJobCompleteOrFail(jobID string) (Response, error) {
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
@@ -125,20 +139,21 @@ func (m *Mixer) waitJobCompleteOrFail(jobID string) (string, error) {
 			if err != nil {
 				return resp, err
 			}
-			if resp != "" {
+			if resp.Output != "" {
 				return resp, nil
 			}
 		case <-timer.C:
-			return "", fmt.Errorf("timed out waiting for job to complete")
+			return Response{}, fmt.Errorf("timed out waiting for job to complete")
 		}
 	}
 }
 
-func checkStatus(apiToken string, jobID string) (string, error) {
+// checkStatus of the prediction, it has an output once it succeeded
+func checkStatus(apiToken string, jobID string) (Response, error) {
 	url := apiUrl + "/" + jobID
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -147,21 +162,21 @@ func checkStatus(apiToken string, jobID string) (string, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 	defer resp.Body.Close()
 
 	var result Response
 	err = json.NewDecoder(resp.Body).Decode(&result)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
 	if result.Status == "succeeded" && result.Output != "" {
-		return result.Output, nil
+		return result, nil
 	}
 
 	log.Infof("Job %s status: %s output %s", jobID, result.Status, result.Output)
 
-	return "", nil
+	return Response{}, nil
 }
@@ -0,0 +1,76 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// DefaultThreshold flags the categories without a threshold of their own
+const DefaultThreshold = 0.5
+
+// Verdict of a moderator on a text, Scores go from 0 (safe) to 1 per category
+type Verdict struct {
+	Flagged bool               `json:"flagged"`
+	Scores  map[string]float64 `json:"scores"`
+	// Categories over their threshold, sorted
+	Categories []string `json:"categories,omitempty"`
+}
+
+// Moderator classifies a text, the OpenAI moderation endpoint or a local classifier
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (Verdict, error)
+}
+
+// Thresholds per category, the "default" key applies to the categories not listed
+type Thresholds map[string]float64
+
+// Verdict of the scores, a category is flagged when its score reaches its threshold
+func (t Thresholds) Verdict(scores map[string]float64) Verdict {
+	verdict := Verdict{Scores: scores}
+
+	for category, score := range scores {
+		if score >= t.threshold(category) {
+			verdict.Categories = append(verdict.Categories, category)
+		}
+	}
+
+	sort.Strings(verdict.Categories)
+	verdict.Flagged = len(verdict.Categories) > 0
+	return verdict
+}
+
+func (t Thresholds) threshold(category string) float64 {
+	if threshold, ok := t[category]; ok {
+		return threshold
+	}
+
+	if threshold, ok := t["default"]; ok {
+		return threshold
+	}
+
+	return DefaultThreshold
+}
+
+// LoadThresholds reads a json object of category thresholds, e.g. {"default": 0.5, "violence": 0.8}
+func LoadThresholds(path string) (Thresholds, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var thresholds Thresholds
+	if err := json.Unmarshal(data, &thresholds); err != nil {
+		return nil, fmt.Errorf("error parsing moderation thresholds %s: %w", path, err)
+	}
+
+	for category, threshold := range thresholds {
+		if threshold <= 0 || threshold > 1 {
+			return nil, fmt.Errorf("invalid threshold %v for %s, must be between 0 and 1", threshold, category)
+		}
+	}
+
+	return thresholds, nil
+}
@@ -0,0 +1,88 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/llumus/lulis/internal/moderation"
+)
+
+const baseUrl = "https://api.openai.com/v1/moderations"
+
+const model = "omni-moderation-latest"
+
+type Payload struct {
+	Input string `json:"input"`
+	Model string `json:"model"`
+}
+
+type Result struct {
+	Flagged        bool               `json:"flagged"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+type Response struct {
+	Results []Result `json:"results"`
+}
+
+// Moderator classifies with the OpenAI moderation endpoint, the scores are judged with our own thresholds
+// instead of the flag of the api
+type Moderator struct {
+	apiKey     string
+	thresholds moderation.Thresholds
+	client     *http.Client
+}
+
+func NewModerator(apiKey string, thresholds moderation.Thresholds, client *http.Client) *Moderator {
+	return &Moderator{
+		apiKey:     apiKey,
+		thresholds: thresholds,
+		client:     client,
+	}
+}
+
+func (m *Moderator) Moderate(ctx context.Context, text string) (moderation.Verdict, error) {
+	jsonData, err := json.Marshal(Payload{Input: text, Model: model})
+	if err != nil {
+		return moderation.Verdict{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return moderation.Verdict{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return moderation.Verdict{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return moderation.Verdict{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return moderation.Verdict{}, fmt.Errorf("moderation status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var response Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return moderation.Verdict{}, err
+	}
+
+	if len(response.Results) == 0 {
+		return moderation.Verdict{}, fmt.Errorf("no moderation result")
+	}
+
+	return m.thresholds.Verdict(response.Results[0].CategoryScores), nil
+}
@@ -0,0 +1,82 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// Engine checks the texts with the rules of a file, reloaded when the file changes
+type Engine struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   *Rules
+	modTime time.Time
+}
+
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{path: path}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *Engine) Check(text string, language string) Verdict {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	return rules.Check(text, language)
+}
+
+// Watch to reload the rules when the file changes until the context is done, invalid rules keep the previous ones
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.reload(); err != nil {
+				log.Errorf("Error reloading moderation rules %s: %v", e.path, err)
+			}
+		}
+	}
+}
+
+func (e *Engine) reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+
+	e.mu.RLock()
+	unchanged := info.ModTime().Equal(e.modTime)
+	e.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	rules, err := Load(e.path)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.modTime = info.ModTime()
+	e.mu.Unlock()
+
+	log.Infof("Loaded %d moderation rules from %s", len(rules.rules), e.path)
+	return nil
+}
@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/llumus/lulis/internal/text"
+)
+
+// leetspeak characters replaced in the words having at least a letter, so numbers are left alone
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's',
+}
+
+// token is a word of the text with its position, Start and End are byte offsets in the original text
+type token struct {
+	Text       string
+	Normalized string
+	Start      int
+	End        int
+}
+
+// tokenize splits the text in words, leetspeak symbols are part of the words
+func tokenize(text string) []token {
+	var (
+		tokens []token
+		start  = -1
+	)
+
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		if start >= 0 {
+			tokens = append(tokens, newToken(text[start:i], start, i))
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		tokens = append(tokens, newToken(text[start:], start, len(text)))
+	}
+
+	return tokens
+}
+
+func newToken(text string, start, end int) token {
+	return token{Text: text, Normalized: Normalize(text), Start: start, End: end}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '@' || r == '$'
+}
+
+// Normalize a word to lower case without diacritics nor leetspeak, "pút4" and "puta" are the same word
+func Normalize(word string) string {
+	leet := strings.IndexFunc(word, unicode.IsLetter) >= 0
+
+	var b strings.Builder
+	for _, r := range text.Fold(word) {
+		if replacement, ok := leetspeak[r]; ok && leet {
+			r = replacement
+		}
+
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// variants of a normalized word with the letters repeated 3 times or more squashed, "fuuuck" is also "fuck"
+func variants(word string) []string {
+	var (
+		single, double strings.Builder
+		runes          = []rune(word)
+		squashed       bool
+	)
+
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+
+		single.WriteRune(runes[i])
+		double.WriteRune(runes[i])
+		if j-i > 1 {
+			double.WriteRune(runes[i])
+		}
+
+		if j-i > 2 {
+			squashed = true
+		} else if j-i == 2 {
+			single.WriteRune(runes[i])
+		}
+
+		i = j
+	}
+
+	if !squashed {
+		return []string{word}
+	}
+
+	return []string{word, single.String(), double.String()}
+}
@@ -0,0 +1,321 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Action of a rule, from the least to the most severe
+type Action string
+
+const (
+	// ActionAlert lets the message through and alerts the moderators
+	ActionAlert Action = "alert"
+	// ActionReplace replaces the matches with the rule replacement
+	ActionReplace Action = "replace"
+	// ActionReject refuses the message
+	ActionReject Action = "reject"
+	// ActionTimeout refuses the message and times out its author
+	ActionTimeout Action = "timeout"
+)
+
+const defaultReplacement = "beep"
+
+var severity = map[Action]int{
+	ActionAlert:   1,
+	ActionReplace: 2,
+	ActionReject:  3,
+	ActionTimeout: 4,
+}
+
+// Rule matches whole words, leetspeak and diacritics included, and regular expressions on the normalized text,
+// e.g. "puta" matches "pút4" and `kill (yo)?urself` matches "K1ll  your-self"
+type Rule struct {
+	Name string `json:"name"`
+	// Languages the rule applies to, all when empty
+	Languages   []string `json:"languages,omitempty"`
+	Words       []string `json:"words,omitempty"`
+	Patterns    []string `json:"patterns,omitempty"`
+	Action      Action   `json:"action"`
+	Replacement string   `json:"replacement,omitempty"`
+	// Timeout of the author for the timeout action, e.g. "10m"
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Ruleset is the moderation rules file, the Allow words are never matched by any rule
+type Ruleset struct {
+	Allow []string `json:"allow,omitempty"`
+	Rules []Rule   `json:"rules"`
+}
+
+// Match of a rule in a text
+type Match struct {
+	Rule   string `json:"rule"`
+	Action Action `json:"action"`
+	Text   string `json:"text"`
+}
+
+// Verdict of the rules on a text, Action is the most severe of the matches and empty when nothing matched
+type Verdict struct {
+	Action  Action        `json:"action,omitempty"`
+	Matches []Match       `json:"matches,omitempty"`
+	Timeout time.Duration `json:"-"`
+	// Text with the matches of the replace rules replaced
+	Text string `json:"text"`
+}
+
+// Refused when the text must not go further
+func (v Verdict) Refused() bool {
+	return v.Action == ActionReject || v.Action == ActionTimeout
+}
+
+type rule struct {
+	Rule
+	words    [][]string
+	patterns []*regexp.Regexp
+	timeout  time.Duration
+}
+
+// Rules compiled from a ruleset
+type Rules struct {
+	allow map[string]bool
+	rules []rule
+}
+
+// Load reads and compiles a ruleset file
+func Load(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ruleset Ruleset
+	if err := json.Unmarshal(data, &ruleset); err != nil {
+		return nil, fmt.Errorf("error parsing moderation rules %s: %w", path, err)
+	}
+
+	return Compile(ruleset)
+}
+
+// Compile the words and patterns of the ruleset
+func Compile(ruleset Ruleset) (*Rules, error) {
+	r := &Rules{allow: make(map[string]bool, len(ruleset.Allow))}
+	for _, word := range ruleset.Allow {
+		r.allow[Normalize(word)] = true
+	}
+
+	for i, definition := range ruleset.Rules {
+		if definition.Name == "" {
+			definition.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+
+		if _, ok := severity[definition.Action]; !ok {
+			return nil, fmt.Errorf("invalid action %q for rule %s", definition.Action, definition.Name)
+		}
+
+		if definition.Action == ActionReplace && definition.Replacement == "" {
+			definition.Replacement = defaultReplacement
+		}
+
+		compiled := rule{Rule: definition}
+
+		for _, word := range definition.Words {
+			var words []string
+			for _, t := range tokenize(word) {
+				words = append(words, t.Normalized)
+			}
+			if len(words) > 0 {
+				compiled.words = append(compiled.words, words)
+			}
+		}
+
+		for _, pattern := range definition.Patterns {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q for rule %s: %w", pattern, definition.Name, err)
+			}
+			compiled.patterns = append(compiled.patterns, re)
+		}
+
+		if definition.Action == ActionTimeout {
+			timeout, err := time.ParseDuration(definition.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout %q for rule %s: %w", definition.Timeout, definition.Name, err)
+			}
+			compiled.timeout = timeout
+		}
+
+		r.rules = append(r.rules, compiled)
+	}
+
+	return r, nil
+}
+
+// Check the text with the rules of the language, all the rules apply when the language is unknown
+func (r *Rules) Check(text string, language string) Verdict {
+	var (
+		tokens       = tokenize(text)
+		normalized   = make([]string, len(tokens))
+		offsets      = make([]int, len(tokens))
+		verdict      = Verdict{Text: text}
+		replacements = map[int]replacement{}
+	)
+
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		offsets[i] = b.Len()
+		normalized[i] = t.Normalized
+		b.WriteString(t.Normalized)
+	}
+	joined := b.String()
+
+	for _, rl := range r.rules {
+		if !rl.appliesTo(language) {
+			continue
+		}
+
+		for _, span := range r.spans(rl, tokens, joined, offsets) {
+			verdict.Matches = append(verdict.Matches, Match{
+				Rule:   rl.Name,
+				Action: rl.Action,
+				Text:   text[tokens[span[0]].Start:tokens[span[1]].End],
+			})
+
+			if severity[rl.Action] > severity[verdict.Action] {
+				verdict.Action = rl.Action
+			}
+
+			if rl.timeout > verdict.Timeout {
+				verdict.Timeout = rl.timeout
+			}
+
+			if rl.Action == ActionReplace {
+				replacements[span[0]] = replacement{last: span[1], text: rl.Replacement}
+			}
+		}
+	}
+
+	verdict.Text = replace(text, tokens, replacements)
+	return verdict
+}
+
+// spans of the tokens matched by the rule, as the first and last token indexes
+func (r *Rules) spans(rl rule, tokens []token, joined string, offsets []int) [][2]int {
+	var spans [][2]int
+
+	for i := range tokens {
+		for _, words := range rl.words {
+			if i+len(words) > len(tokens) {
+				continue
+			}
+
+			matched := true
+			for j, word := range words {
+				if !matchesWord(tokens[i+j].Normalized, word) {
+					matched = false
+					break
+				}
+			}
+
+			if matched && !r.allowed(tokens, i, i+len(words)-1) {
+				spans = append(spans, [2]int{i, i + len(words) - 1})
+			}
+		}
+	}
+
+	for _, re := range rl.patterns {
+		for _, loc := range re.FindAllStringIndex(joined, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+
+			first := sort.SearchInts(offsets, loc[0]+1) - 1
+			last := sort.SearchInts(offsets, loc[1]) - 1
+			if first < 0 || last < first {
+				continue
+			}
+
+			if !r.allowed(tokens, first, last) {
+				spans = append(spans, [2]int{first, last})
+			}
+		}
+	}
+
+	return spans
+}
+
+// allowed when every token of the span is in the allowlist
+func (r *Rules) allowed(tokens []token, first, last int) bool {
+	for i := first; i <= last; i++ {
+		if !r.allow[tokens[i].Normalized] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (rl rule) appliesTo(language string) bool {
+	if language == "" || len(rl.Languages) == 0 {
+		return true
+	}
+
+	for _, l := range rl.Languages {
+		if strings.EqualFold(l, language) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesWord(token string, word string) bool {
+	for _, variant := range variants(token) {
+		if variant == word {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replacement of the tokens from the one it is indexed by to the last one
+type replacement struct {
+	last int
+	text string
+}
+
+// replace the spans of the replace rules in the original text, overlapping spans keep the first one
+func replace(text string, tokens []token, replacements map[int]replacement) string {
+	if len(replacements) == 0 {
+		return text
+	}
+
+	var (
+		b    strings.Builder
+		last = 0
+	)
+
+	for i := 0; i < len(tokens); i++ {
+		r, ok := replacements[i]
+		if !ok {
+			continue
+		}
+
+		b.WriteString(text[last:tokens[i].Start])
+		b.WriteString(r.text)
+		last = tokens[r.last].End
+		i = r.last
+	}
+
+	b.WriteString(text[last:])
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package rules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	r, err := Compile(Ruleset{
+		Allow: []string{"sextant"},
+		Rules: []Rule{
+			{Name: "sexual", Patterns: []string{`\bsex\w*`}, Action: ActionReject},
+			{Name: "harassment", Words: []string{"kys"}, Patterns: []string{`\bkill (yo)?ur ?self\b`}, Action: ActionTimeout, Timeout: "10m"},
+			{Name: "profanity-pt", Languages: []string{"pt"}, Words: []string{"puta", "merda"}, Action: ActionReplace, Replacement: "bip"},
+			{Name: "profanity-en", Languages: []string{"en"}, Words: []string{"shit", "fuck"}, Action: ActionReplace},
+			{Name: "insults", Words: []string{"idiota"}, Action: ActionAlert},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		language string
+		action   Action
+		want     string
+		timeout  time.Duration
+	}{
+		{"clean", "what is the capital of Brazil?", "en", "", "what is the capital of Brazil?", 0},
+		{"leetspeak and diacritics", "que pút4 pergunta", "pt", ActionReplace, "que bip pergunta", 0},
+		{"repeated letters", "fuuuck this", "en", ActionReplace, "beep this", 0},
+		{"rule of another language", "que merda", "en", "", "que merda", 0},
+		{"unknown language applies every rule", "shit, que merda", "", ActionReplace, "beep, que bip", 0},
+		{"pattern across words", "K1ll  your-self", "en", ActionTimeout, "K1ll  your-self", 10 * time.Minute},
+		{"allowed word", "a sextant for the sailors", "en", "", "a sextant for the sailors", 0},
+		{"pattern next to an allowed word", "sextant sexy", "en", ActionReject, "sextant sexy", 0},
+		{"most severe action", "idiota de merda", "pt", ActionReplace, "idiota de bip", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := r.Check(tt.text, tt.language)
+
+			if verdict.Action != tt.action || verdict.Text != tt.want {
+				t.Errorf("Check() = %q %q, want %q %q", verdict.Action, verdict.Text, tt.action, tt.want)
+			}
+			if verdict.Timeout != tt.timeout {
+				t.Errorf("Check() timeout = %v, want %v", verdict.Timeout, tt.timeout)
+			}
+			if verdict.Refused() != (tt.action == ActionReject || tt.action == ActionTimeout) {
+				t.Errorf("Refused() = %v for %q", verdict.Refused(), tt.action)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"pút4", "puta"},
+		{"$h1t", "shit"},
+		{"Ação", "acao"},
+		{"2024", "2024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			if got := Normalize(tt.word); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const bansUrl = "https://api.twitch.tv/helix/moderation/bans"
+
+type Ban struct {
+	UserID   string `json:"user_id"`
+	Duration int    `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+type Payload struct {
+	Data Ban `json:"data"`
+}
+
+// Moderation times out chatters with the Twitch api, the chat commands are not supported over irc anymore
+type Moderation struct {
+	clientID    string
+	token       string
+	moderatorID string
+	client      *http.Client
+}
+
+// NewModeration token is a user access token of the moderator with the moderator:manage:banned_users scope,
+// the "oauth:" prefix of the irc token is removed
+func NewModeration(clientID string, token string, moderatorID string, client *http.Client) *Moderation {
+	return &Moderation{
+		clientID:    clientID,
+		token:       strings.TrimPrefix(token, "oauth:"),
+		moderatorID: moderatorID,
+		client:      client,
+	}
+}
+
+// Timeout the user in the chat of the broadcaster, Twitch accepts from 1 second to 2 weeks
+func (m *Moderation) Timeout(ctx context.Context, broadcasterID string, userID string, duration time.Duration, reason string) error {
+	seconds := int(duration.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	jsonData, err := json.Marshal(Payload{Data: Ban{UserID: userID, Duration: seconds, Reason: reason}})
+	if err != nil {
+		return err
+	}
+
+	url := bansUrl + "?broadcaster_id=" + broadcasterID + "&moderator_id=" + m.moderatorID
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	req.Header.Set("Client-Id", m.clientID)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("timeout status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
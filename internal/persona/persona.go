@@ -0,0 +1,307 @@
+package persona
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/llumus/lulis/internal/language"
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.New()
+
+// Example is a question and the answer expected from the persona, used as few-shot examples
+type Example struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// Variant of the system prompt of the persona for the A/B experiments, an empty prompt is the one of the persona
+type Variant struct {
+	Name string `json:"name"`
+	// Weight of the variant in the assignments, 1 by default
+	Weight       float64 `json:"weight,omitempty"`
+	SystemPrompt string  `json:"system_prompt,omitempty"`
+}
+
+// Persona is the character the stream impersonates, it drives the gpt prompts, the tts voice and the lip sync face.
+// The prompts are text/template templates, e.g. {{.Viewer}} or {{.TimeOfDay}}, see gpt.Vars
+type Persona struct {
+	Name     string `json:"name"`
+	Trigger  string `json:"trigger"`
+	Language string `json:"language"`
+	// Languages the persona can also answer in, in the language of the viewer, any detected language when empty.
+	// The voice has to speak them, as the eleven_multilingual_v2 voices do
+	Languages []string `json:"languages,omitempty"`
+	// Description is a short character sheet, used when the persona is in a dialogue with other personas
+	Description string `json:"description,omitempty"`
+
+	SystemPrompt string    `json:"system_prompt"`
+	Examples     []Example `json:"examples"`
+
+	QuestionPrompt   string    `json:"question_prompt"`
+	QuestionExamples []Example `json:"question_examples"`
+	// QuestionRequest asks for a new question, {topic} is replaced by a topic picked by its weight
+	QuestionRequest string   `json:"question_request"`
+	Topics          []string `json:"topics"`
+	// TopicWeights makes some topics picked more often than others, 1 for the topics without weight, 0 never picks it
+	TopicWeights map[string]float64 `json:"topic_weights,omitempty"`
+
+	VoiceID      string `json:"voice_id,omitempty"`
+	FaceVideoURL string `json:"face_video_url,omitempty"`
+	// WordsPerSecond is the speaking rate of the voice, to estimate how long an answer takes to be spoken
+	WordsPerSecond float64 `json:"words_per_second,omitempty"`
+	// MaxAnswerSeconds overrides the default spoken duration budget of the answers
+	MaxAnswerSeconds float64 `json:"max_answer_seconds,omitempty"`
+
+	// Variants of the prompts run side by side, none for no experiment
+	Variants []Variant `json:"variants,omitempty"`
+}
+
+// AnswerLanguage is the language of the viewer when the persona can answer in it, its own language otherwise
+func (p *Persona) AnswerLanguage(viewer string) string {
+	if viewer == "" || language.Base(viewer) == language.Base(p.Language) {
+		return p.Language
+	}
+
+	if len(p.Languages) == 0 {
+		return viewer
+	}
+
+	for _, l := range p.Languages {
+		if language.Base(l) == language.Base(viewer) {
+			return l
+		}
+	}
+
+	return p.Language
+}
+
+// WithVariant is a copy of the persona with the prompt of the variant, the persona itself for an unknown variant
+func (p *Persona) WithVariant(name string) *Persona {
+	for _, v := range p.Variants {
+		if v.Name != name {
+			continue
+		}
+
+		c := *p
+		if v.SystemPrompt != "" {
+			c.SystemPrompt = v.SystemPrompt
+		}
+		return &c
+	}
+
+	return p
+}
+
+// templates of the persona prompts, checked when the persona is loaded
+func (p *Persona) templates() map[string]string {
+	templates := map[string]string{
+		"system_prompt":    p.SystemPrompt,
+		"description":      p.Description,
+		"question_prompt":  p.QuestionPrompt,
+		"question_request": p.QuestionRequest,
+	}
+
+	for _, v := range p.Variants {
+		templates[v.Name+" system_prompt"] = v.SystemPrompt
+	}
+
+	return templates
+}
+
+func Load(path string) (*Persona, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Persona
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("error parsing persona %s: %w", path, err)
+	}
+
+	if p.Name == "" || p.Trigger == "" || p.SystemPrompt == "" {
+		return nil, fmt.Errorf("persona %s needs a name, a trigger and a system prompt", path)
+	}
+
+	names := make(map[string]bool, len(p.Variants))
+	for _, v := range p.Variants {
+		if v.Name == "" || names[v.Name] {
+			return nil, fmt.Errorf("persona %s variants need a unique name", path)
+		}
+		names[v.Name] = true
+	}
+
+	for name, text := range p.templates() {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("persona %s has a broken %s template: %w", path, name, err)
+		}
+	}
+
+	return &p, nil
+}
+
+// Store keeps the personas loaded from a folder of json files, or a single file, and reloads them when the files change
+type Store struct {
+	mu       sync.RWMutex
+	path     string
+	personas []*Persona
+	version  string
+}
+
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get the persona by name, case insensitive
+func (s *Store) Get(name string) (*Persona, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.personas {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+
+	return nil, false
+}
+
+// Default is the first persona by file name
+func (s *Store) Default() *Persona {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.personas[0]
+}
+
+func (s *Store) All() []*Persona {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]*Persona(nil), s.personas...)
+}
+
+// Match the persona addressed by the message, the longest trigger wins when triggers share a prefix
+func (s *Store) Match(message string) (*Persona, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var match *Persona
+	for _, p := range s.personas {
+		if strings.HasPrefix(message, p.Trigger) && (match == nil || len(p.Trigger) > len(match.Trigger)) {
+			match = p
+		}
+	}
+
+	return match, match != nil
+}
+
+// Watch checks the files every interval until the context is done, broken files keep the previous personas
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.reload(); err != nil {
+				log.Errorf("Error reloading personas %s: %v", s.path, err)
+			}
+		}
+	}
+}
+
+func (s *Store) reload() error {
+	files, version, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	unchanged := version == s.version
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	personas := make([]*Persona, 0, len(files))
+	for _, file := range files {
+		p, err := Load(file)
+		if err != nil {
+			return err
+		}
+		personas = append(personas, p)
+	}
+
+	if len(personas) == 0 {
+		return fmt.Errorf("no persona found in %s", s.path)
+	}
+
+	s.mu.Lock()
+	s.personas = personas
+	s.version = version
+	s.mu.Unlock()
+
+	for _, p := range personas {
+		log.Infof("Loaded persona %s with trigger %q", p.Name, p.Trigger)
+	}
+
+	return nil
+}
+
+// files lists the persona files sorted by name, the version changes when any file is added, removed or modified
+func (s *Store) files() ([]string, string, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	files := []string{s.path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(s.path, "*.json"))
+		if err != nil {
+			return nil, "", err
+		}
+		sort.Strings(files)
+	}
+
+	var version strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, "", err
+		}
+		_, _ = fmt.Fprintf(&version, "%s:%d;", file, info.ModTime().UnixNano())
+	}
+
+	return files, version.String(), nil
+}
+
+type contextKey struct{}
+
+// NewContext carries the persona answering a job through the gpt, tts and mixer stages
+func NewContext(ctx context.Context, p *Persona) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+func FromContext(ctx context.Context) (*Persona, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Persona)
+	return p, ok && p != nil
+}
@@ -39,3 +39,10 @@ func (q *Queue) Dequeue() (string, bool) {
 	q.data = q.data[1:]
 	return message, true
 }
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.data)
+}
@@ -3,4 +3,5 @@ package queue
 type Queue interface {
 	Enqueue(message string)
 	Dequeue() (string, bool)
+	Len() int
 }
@@ -0,0 +1,167 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultInterval = 2 * time.Minute
+
+// Queue conditions of a scene
+const (
+	QueueAny  = ""
+	QueueIdle = "idle"
+	QueueBusy = "busy"
+)
+
+var log = logrus.New()
+
+// Scene is an idle loop video that plays while there is no answer to play
+type Scene struct {
+	Name string `json:"name"`
+	// File is the video file name, relative to the stream tmp folder
+	File string `json:"file"`
+	// Weight is the chance of the scene to be picked compared to the other eligible scenes
+	Weight int `json:"weight"`
+	// Hours of the day the scene is allowed to play, empty means any hour
+	Hours []int `json:"hours,omitempty"`
+	// Queue restricts the scene to an idle (no pending questions) or busy queue, empty means any
+	Queue string `json:"queue,omitempty"`
+}
+
+// Manifest lists the idle scenes and how often they rotate
+type Manifest struct {
+	Interval string  `json:"interval"`
+	Scenes   []Scene `json:"scenes"`
+
+	interval time.Duration
+}
+
+// LoadManifest reads the manifest and drops the scenes whose file is missing in dir
+func LoadManifest(path string, dir string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing scene manifest %s: %w", path, err)
+	}
+
+	manifest.interval = defaultInterval
+	if manifest.Interval != "" {
+		manifest.interval, err = time.ParseDuration(manifest.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scene interval %s: %w", manifest.Interval, err)
+		}
+	}
+
+	scenes := make([]Scene, 0, len(manifest.Scenes))
+	for _, scene := range manifest.Scenes {
+		if _, err := os.Stat(filepath.Join(dir, scene.File)); err != nil {
+			log.Warnf("Skipping scene %s, file %s not found", scene.Name, scene.File)
+			continue
+		}
+
+		if scene.Weight <= 0 {
+			scene.Weight = 1
+		}
+
+		scenes = append(scenes, scene)
+	}
+
+	if len(scenes) == 0 {
+		return nil, fmt.Errorf("scene manifest %s has no playable scenes", path)
+	}
+
+	manifest.Scenes = scenes
+	return &manifest, nil
+}
+
+// RotationInterval is how often the scheduler should pick the next scene
+func (m *Manifest) RotationInterval() time.Duration {
+	return m.interval
+}
+
+// Scheduler picks the next idle scene according to the time of day, the queue state and the scene weights
+type Scheduler struct {
+	manifest *Manifest
+	current  Scene
+}
+
+func NewScheduler(manifest *Manifest) *Scheduler {
+	return &Scheduler{
+		manifest: manifest,
+	}
+}
+
+// Current is the last picked scene
+func (s *Scheduler) Current() Scene {
+	return s.current
+}
+
+// Next picks a weighted random scene among the ones allowed at the given time and queue length,
+// if no scene is allowed the current one keeps playing
+func (s *Scheduler) Next(now time.Time, queueLength int) Scene {
+	var (
+		eligible = make([]Scene, 0, len(s.manifest.Scenes))
+		total    int
+	)
+
+	for _, scene := range s.manifest.Scenes {
+		if scene.allowed(now, queueLength) {
+			eligible = append(eligible, scene)
+			total += scene.Weight
+		}
+	}
+
+	if len(eligible) == 0 {
+		if s.current.File == "" {
+			s.current = s.manifest.Scenes[0]
+		}
+		return s.current
+	}
+
+	pick := rand.Intn(total)
+	for _, scene := range eligible {
+		pick -= scene.Weight
+		if pick < 0 {
+			s.current = scene
+			break
+		}
+	}
+
+	return s.current
+}
+
+func (s Scene) allowed(now time.Time, queueLength int) bool {
+	switch s.Queue {
+	case QueueIdle:
+		if queueLength > 0 {
+			return false
+		}
+	case QueueBusy:
+		if queueLength == 0 {
+			return false
+		}
+	}
+
+	if len(s.Hours) == 0 {
+		return true
+	}
+
+	for _, hour := range s.Hours {
+		if hour == now.Hour() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	width  = 1280
+	height = 720
+	fps    = 25
+)
+
+// Stitcher re-encodes the videos to the same size, frame rate and audio format and concatenates them,
+// the outputs rotate over maxFileSlots files in the tmp folder like the downloaded videos
+type Stitcher struct {
+	dir          string
+	maxFileSlots int
+
+	mu   sync.Mutex
+	slot int
+}
+
+func NewStitcher(dir string, maxFileSlots int) *Stitcher {
+	return &Stitcher{
+		dir:          dir,
+		maxFileSlots: maxFileSlots,
+	}
+}
+
+func (s *Stitcher) Stitch(ctx context.Context, videoPaths []string) (string, error) {
+	if len(videoPaths) == 0 {
+		return "", fmt.Errorf("no videos to stitch")
+	}
+
+	s.mu.Lock()
+	s.slot = (s.slot + 1) % s.maxFileSlots
+	outputPath := filepath.Join(s.dir, "stitched"+strconv.Itoa(s.slot)+".mp4")
+	s.mu.Unlock()
+
+	var (
+		args    = []string{"-y"}
+		filters []string
+		concat  strings.Builder
+	)
+
+	for i, path := range videoPaths {
+		args = append(args, "-i", path)
+		filters = append(filters,
+			fmt.Sprintf("[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%d[v%d]", i, width, height, width, height, fps, i),
+			fmt.Sprintf("[%d:a]aresample=44100,aformat=channel_layouts=stereo[a%d]", i, i),
+		)
+		_, _ = fmt.Fprintf(&concat, "[v%d][a%d]", i, i)
+	}
+
+	filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=1[v][a]", concat.String(), len(videoPaths)))
+
+	args = append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", "[v]",
+		"-map", "[a]",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		outputPath,
+	)
+
+	if output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return "", fmt.Errorf("error stitching videos: %w: %s", err, lines[len(lines)-1])
+	}
+
+	return outputPath, nil
+}
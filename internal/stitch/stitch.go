@@ -0,0 +1,8 @@
+package stitch
+
+import "context"
+
+type Stitcher interface {
+	// Stitch joins the videos in order into a single video and returns its local path
+	Stitch(ctx context.Context, videoPaths []string) (string, error)
+}
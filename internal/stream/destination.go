@@ -0,0 +1,149 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DefaultReconnectPolicy is used by destinations without a reconnect policy
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: Duration(time.Second),
+	MaxDelay:     Duration(time.Minute),
+	Multiplier:   2,
+	Jitter:       0.2,
+	MaxAttempts:  10,
+}
+
+// Destination is where the stream is published, rtmp://, rtmps:// and srt:// urls are supported
+type Destination struct {
+	Name      string           `json:"name"`
+	URL       string           `json:"url"`
+	Reconnect *ReconnectPolicy `json:"reconnect,omitempty"`
+}
+
+// Format is the ffmpeg muxer for the destination protocol
+func (d Destination) Format() (string, error) {
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "rtmp", "rtmps":
+		return "flv", nil
+	case "srt":
+		return "mpegts", nil
+	}
+
+	return "", fmt.Errorf("unsupported protocol %q for destination %s", u.Scheme, d.Name)
+}
+
+// Policy is the destination reconnect policy or the default one
+func (d Destination) Policy() ReconnectPolicy {
+	if d.Reconnect == nil {
+		return DefaultReconnectPolicy
+	}
+
+	return *d.Reconnect
+}
+
+// ReconnectPolicy is an exponential backoff with jitter, MaxAttempts consecutive failures raise an alert
+type ReconnectPolicy struct {
+	InitialDelay Duration `json:"initial_delay"`
+	MaxDelay     Duration `json:"max_delay"`
+	Multiplier   float64  `json:"multiplier"`
+	Jitter       float64  `json:"jitter"`
+	MaxAttempts  int      `json:"max_attempts"`
+}
+
+// UnmarshalJSON starts from the default policy, the fields missing in the json keep their default so a partial policy
+// never reconnects in a tight loop, and an explicit 0 is kept, e.g. "max_attempts": 0 never raises an alert
+func (p *ReconnectPolicy) UnmarshalJSON(data []byte) error {
+	type plain ReconnectPolicy
+	policy := plain(DefaultReconnectPolicy)
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+
+	*p = ReconnectPolicy(policy)
+	return nil
+}
+
+// Delay before the given attempt, attempts start at 1
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// Duration is a time.Duration written as "1m30s" in json
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadDestinations reads a json list of destinations and validates their protocols
+func LoadDestinations(path string) ([]Destination, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var destinations []Destination
+	if err := json.Unmarshal(data, &destinations); err != nil {
+		return nil, fmt.Errorf("error parsing destinations %s: %w", path, err)
+	}
+
+	if len(destinations) == 0 {
+		return nil, fmt.Errorf("no destinations in %s", path)
+	}
+
+	for i, destination := range destinations {
+		if destination.Name == "" {
+			destinations[i].Name = fmt.Sprintf("destination-%d", i+1)
+		}
+
+		if _, err := destinations[i].Format(); err != nil {
+			return nil, err
+		}
+	}
+
+	return destinations, nil
+}
@@ -0,0 +1,40 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want ReconnectPolicy
+	}{
+		{"no policy", `{"url": "rtmp://localhost/live"}`, DefaultReconnectPolicy},
+		{
+			"partial policy",
+			`{"url": "rtmp://localhost/live", "reconnect": {"max_delay": "30s"}}`,
+			ReconnectPolicy{InitialDelay: Duration(time.Second), MaxDelay: Duration(30 * time.Second), Multiplier: 2, Jitter: 0.2, MaxAttempts: 10},
+		},
+		{
+			"explicit zeros",
+			`{"url": "rtmp://localhost/live", "reconnect": {"jitter": 0, "max_attempts": 0}}`,
+			ReconnectPolicy{InitialDelay: Duration(time.Second), MaxDelay: Duration(time.Minute), Multiplier: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Destination
+			if err := json.Unmarshal([]byte(tt.json), &d); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			if got := d.Policy(); got != tt.want {
+				t.Errorf("Policy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
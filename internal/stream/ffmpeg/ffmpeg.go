@@ -2,60 +2,113 @@ package ffmpeg
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/llumus/lulis/internal/media"
+	"github.com/llumus/lulis/internal/stream"
+	"github.com/llumus/lulis/internal/stream/layout"
 	"github.com/sirupsen/logrus"
 )
 
-type FFProbeOutput struct {
-	Format Format `json:"format"`
-}
-
-type Format struct {
-	Duration string `json:"duration"`
-}
-
 type Stream struct {
 	playlistPath     string
 	tempPlaylistPath string
 	currentCmd       *exec.Cmd
 	stdout           io.ReadCloser
 	reader           *bufio.Reader
-	twitchStreamKey  string
+	layout           *layout.Layout
+	relays           []*relay
+	relaysOnce       sync.Once
 	isAwaitingFinish bool
+
+	// mu protects the idle loop, the playing state shared by PlayLatest and SetIdleLoop and the status
+	mu          sync.Mutex
+	idleLoop    string
+	isPlaying   bool
+	isStopping  bool
+	running     bool
+	startedAt   time.Time
+	currentItem string
+	lastError   string
+	restarts    int
+	// sequence is the slot of the sequence files of the last PlaySequence
+	sequence int
+
+	events chan stream.Event
 }
 
+const defaultIdleLoop = "loop.mp4"
+
 var log = logrus.New()
 
-func NewStream(twitchStreamKey string, playlistPath string) *Stream {
+// NewStream the layout is optional, without it the playlist is streamed full frame
+func NewStream(destinations []stream.Destination, playlistPath string, layout *layout.Layout) *Stream {
 	if err := copyAssetsToTmp(playlistPath); err != nil {
 		log.Fatalf("Error copying assets to tmp: %s", err)
 	}
-	return &Stream{
+	s := &Stream{
 		playlistPath:     playlistPath,
 		tempPlaylistPath: strings.Replace(playlistPath, "playlist.txt", "temp_playlist.txt", 1),
-		twitchStreamKey:  twitchStreamKey,
+		idleLoop:         defaultIdleLoop,
+		layout:           layout,
+		events:           make(chan stream.Event, 64),
+	}
+
+	for i, destination := range destinations {
+		r, err := newRelay(destination, i)
+		if err != nil {
+			log.Fatalf("Error configuring destination %s: %s", destination.Name, err)
+		}
+		s.relays = append(s.relays, r)
+	}
+
+	// a previous run may have stopped while playing an answer or another idle loop
+	for _, path := range []string{s.playlistPath, s.tempPlaylistPath} {
+		if err := s.replaceSecondLine(path, "file '"+defaultIdleLoop+"'"); err != nil {
+			log.Errorf("Error resetting playlist %s: %s", path, err)
+		}
 	}
+
+	return s
 }
 
-func (s *Stream) StartStream() error {
-	s.currentCmd = exec.Command("ffmpeg",
+func (s *Stream) StartStream(ctx context.Context) error {
+	// the relays outlive the encoder restarts, they wait for the feed to come back
+	s.relaysOnce.Do(func() {
+		for _, r := range s.relays {
+			go r.run(ctx, s.emit)
+		}
+	})
+
+	feeds := make([]string, 0, len(s.relays))
+	for _, r := range s.relays {
+		feeds = append(feeds, r.feed())
+	}
+
+	video, err := s.videoArgs()
+	if err != nil {
+		return s.fail(err)
+	}
+
+	args := append([]string{
 		"-re",
 		"-loglevel", "verbose",
 		"-stream_loop", "-1",
 		"-f", "concat",
 		"-safe", "0",
 		"-i", s.playlistPath,
-		"-vf", "scale=1280:720",
+	}, video...)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", append(args,
 		"-pix_fmt", "yuv420p",
 		"-bufsize", "2000k",
 		"-b:v", "2000k",
@@ -69,46 +122,124 @@ func (s *Stream) StartStream() error {
 		"-map_metadata", "-1", // Strip unnecessary metadata
 		"-r", "24",
 		"-g", "48",
-		"-f", "flv",
-		"rtmp://live.twitch.tv/app/"+s.twitchStreamKey)
+		"-map", "0:a",
+		"-f", "tee",
+		strings.Join(feeds, "|"))...)
 
-	var err error
-	s.stdout, err = s.currentCmd.StderrPipe()
+	stdout, err := cmd.StderrPipe()
 	if err != nil {
-		return err
+		return s.fail(err)
+	}
+
+	s.reader = bufio.NewReader(stdout)
+
+	if err := cmd.Start(); err != nil {
+		return s.fail(err)
+	}
+
+	s.mu.Lock()
+	s.currentCmd = cmd
+	s.stdout = stdout
+	s.running = true
+	s.isStopping = false
+	s.startedAt = time.Now()
+	s.mu.Unlock()
+
+	s.emit(stream.Event{Type: stream.EventStarted})
+
+	go s.printStdOut(stdout)
+	err = cmd.Wait()
+
+	s.mu.Lock()
+	s.running = false
+	s.restarts++
+	stopped := s.isStopping || ctx.Err() != nil
+	s.mu.Unlock()
+
+	if stopped {
+		s.emit(stream.Event{Type: stream.EventStopped})
+		return nil
+	}
+
+	if err == nil {
+		err = fmt.Errorf("ffmpeg exited")
 	}
 
-	s.reader = bufio.NewReader(s.stdout)
+	return s.fail(err)
+}
+
+// videoArgs maps the video full frame or composed by the layout
+func (s *Stream) videoArgs() ([]string, error) {
+	if s.layout == nil {
+		return []string{"-map", "0:v", "-vf", "scale=1280:720"}, nil
+	}
 
-	err = s.currentCmd.Start()
+	args, err := layoutArgs(s.layout)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	go s.printStdOut(s.stdout)
-	return s.currentCmd.Wait()
+	return append(args, "-map", "[vout]"), nil
 }
 
 func (s *Stream) StopStream() error {
-	if s.currentCmd == nil || s.currentCmd.Process == nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running || s.currentCmd == nil || s.currentCmd.Process == nil {
 		return fmt.Errorf("no stream is currently running")
 	}
 
-	if err := s.currentCmd.Process.Kill(); err != nil {
-		return err
+	// StartStream is waiting on the process and reports the stop
+	s.isStopping = true
+	return s.currentCmd.Process.Kill()
+}
+
+func (s *Stream) Status() stream.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := stream.Status{
+		Running:     s.running,
+		StartedAt:   s.startedAt,
+		CurrentItem: s.currentItem,
+		IdleLoop:    s.idleLoop,
+		LastError:   s.lastError,
+		Restarts:    s.restarts,
+	}
+
+	status.Destinations = make(map[string]stream.DestinationStatus, len(s.relays))
+	for _, r := range s.relays {
+		status.Destinations[r.destination.Name] = r.status()
 	}
 
-	return s.currentCmd.Wait()
+	if s.running {
+		status.Uptime = time.Since(s.startedAt).Round(time.Second)
+	}
+
+	return status
+}
+
+func (s *Stream) Events() <-chan stream.Event {
+	return s.events
 }
 
-func (s *Stream) PlayLatest(path string) error {
-	if err := s.replaceSecondLine(s.tempPlaylistPath, "file '"+filepath.Base(path)+"'"); err != nil {
+func (s *Stream) PlayLatest(ctx context.Context, path string) error {
+	s.mu.Lock()
+	s.isPlaying = true
+	s.currentItem = path
+	err := s.replaceSecondLine(s.tempPlaylistPath, "file '"+filepath.Base(path)+"'")
+	s.mu.Unlock()
+	if err != nil {
+		s.finishItem()
 		return err
 	}
 
+	s.emit(stream.Event{Type: stream.EventItemStarted, Item: path})
+
 	log.Infof("Replaced playlist should play now, will wait for finish %s", path)
 
-	duration, err := s.getVideoDuration(path)
+	duration, err := media.Duration(path)
 	if err != nil {
 		log.Errorf("Error getting video duration: %s", err)
 		duration = 10
@@ -117,13 +248,78 @@ func (s *Stream) PlayLatest(path string) error {
 	roundDuration := time.Duration((duration + 2) * float64(time.Second))
 	log.Infof("Waiting for %s", roundDuration)
 
-	time.Sleep(roundDuration)
+	timer := time.NewTimer(roundDuration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		log.Infof("Done waiting for %s putting loop back", roundDuration)
+	case <-ctx.Done():
+		log.Infof("Playing %s cancelled, putting loop back", path)
+	}
+
+	if err := s.finishItem(); err != nil {
+		return err
+	}
+
+	s.emit(stream.Event{Type: stream.EventItemFinished, Item: path, Err: ctx.Err()})
+	return ctx.Err()
+}
+
+// finishItem puts the idle loop back in the temp playlist
+func (s *Stream) finishItem() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.isPlaying = false
+	s.currentItem = ""
+	return s.replaceSecondLine(s.tempPlaylistPath, "file '"+s.idleLoop+"'")
+}
+
+func (s *Stream) fail(err error) error {
+	s.mu.Lock()
+	s.lastError = err.Error()
+	s.mu.Unlock()
+
+	s.emit(stream.Event{Type: stream.EventCrashed, Err: err})
+	return err
+}
+
+// emit never blocks, events are dropped when nobody is consuming them
+func (s *Stream) emit(event stream.Event) {
+	event.Time = time.Now()
+
+	select {
+	case s.events <- event:
+	default:
+		log.Warnf("Dropping stream event %s, channel is full", event.Type)
+	}
+}
+
+// SetIdleLoop changes the video played between answers, it must be in the same folder as the playlist
+func (s *Stream) SetIdleLoop(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	log.Infof("Done waiting for %s putting loop back", roundDuration)
-	if err := s.replaceSecondLine(s.tempPlaylistPath, "file 'loop.mp4'"); err != nil {
+	loop := filepath.Base(path)
+	if loop == s.idleLoop {
+		return nil
+	}
+
+	if err := s.replaceSecondLine(s.playlistPath, "file '"+loop+"'"); err != nil {
 		return err
 	}
 
+	// while an answer is playing the temp playlist is restored by PlayLatest
+	if !s.isPlaying {
+		if err := s.replaceSecondLine(s.tempPlaylistPath, "file '"+loop+"'"); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Idle loop changed from %s to %s", s.idleLoop, loop)
+	s.idleLoop = loop
+
 	return nil
 }
 
@@ -147,29 +343,6 @@ func (s *Stream) printStdOut(stdout io.ReadCloser) {
 	}
 }
 
-func (s *Stream) getVideoDuration(filepath string) (float64, error) {
-	// Run ffprobe to get video details in JSON format
-	cmd := exec.Command("ffprobe", "-v", "error", "-show_format", "-of", "json", filepath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return 0, err
-	}
-
-	// Parse the JSON output
-	var probeOutput FFProbeOutput
-	if err := json.Unmarshal(output, &probeOutput); err != nil {
-		return 0, err
-	}
-
-	// Convert duration string to float64 and return
-	duration, err := strconv.ParseFloat(probeOutput.Format.Duration, 64)
-	if err != nil {
-		return 0, err
-	}
-
-	return duration, nil
-}
-
 func (s *Stream) replaceSecondLine(filename, newLine string) error {
 	// Read the file into memory
 	input, err := os.ReadFile(filename)
@@ -203,6 +376,11 @@ func copyAssetsToTmp(playlistPath string) error {
 		}
 
 		for _, file := range files {
+			// the folders of the assets are the personas, knowledge and locales, not videos
+			if file.IsDir() {
+				continue
+			}
+
 			sourceFile := filepath.Join(assetsDir, file.Name())
 			destFile := filepath.Join(tmpDir, file.Name())
 
@@ -0,0 +1,124 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/llumus/lulis/internal/stream/layout"
+)
+
+// layoutArgs are the inputs and the filter graph composing the layout layers on top of each other,
+// the playlist is the input 0 and the images are added as looped inputs that are re-read when their file changes
+func layoutArgs(l *layout.Layout) ([]string, error) {
+	var (
+		inputs  []string
+		filters = []string{fmt.Sprintf("color=c=%s:s=%dx%d:r=24[base0]", l.Background, l.Width, l.Height)}
+		base    = "base0"
+		images  = 0
+	)
+
+	for i, layer := range l.Layers {
+		next := "base" + strconv.Itoa(i+1)
+
+		switch layer.Type {
+		case layout.LayerFace:
+			filters = append(filters,
+				fmt.Sprintf("[0:v]scale=%d:%d,setsar=1[layer%d]", layer.Width, layer.Height, i),
+				fmt.Sprintf("[%s][layer%d]overlay=x=%d:y=%d[%s]", base, i, layer.X, layer.Y, next),
+			)
+		case layout.LayerImage:
+			if layer.Source == layout.SourceOverlay {
+				if err := ensureOverlayFile(layer.Path); err != nil {
+					return nil, err
+				}
+			}
+			images++
+			inputs = append(inputs, "-re", "-f", "image2", "-loop", "1", "-framerate", "1", "-i", layer.Path)
+			filters = append(filters,
+				fmt.Sprintf("[%d:v]scale=%d:%d,format=rgba[layer%d]", images, layer.Width, layer.Height, i),
+				fmt.Sprintf("[%s][layer%d]overlay=x=%d:y=%d:eof_action=repeat[%s]", base, i, layer.X, layer.Y, next),
+			)
+		case layout.LayerText, layout.LayerTicker:
+			if err := ensureTextFile(layer.Path); err != nil {
+				return nil, err
+			}
+			filters = append(filters, fmt.Sprintf("[%s]%s[%s]", base, textFilter(l, layer), next))
+		}
+
+		base = next
+	}
+
+	filters = append(filters, fmt.Sprintf("[%s]format=yuv420p[vout]", base))
+
+	return append(inputs, "-filter_complex", strings.Join(filters, ";")), nil
+}
+
+// textFilter draws the box and the text of the layer, the text is not expanded so chat messages are printed as they are
+func textFilter(l *layout.Layout, layer layout.Layer) string {
+	var (
+		fontSize  = layer.FontSize
+		fontColor = layer.FontColor
+		font      string
+		x         = strconv.Itoa(layer.X + 10)
+	)
+
+	if fontSize <= 0 {
+		fontSize = 24
+	}
+
+	if fontColor == "" {
+		fontColor = "white"
+	}
+
+	if l.Font != "" {
+		font = ":fontfile='" + l.Font + "'"
+	}
+
+	if layer.Type == layout.LayerTicker {
+		speed := layer.Speed
+		if speed <= 0 {
+			speed = 100
+		}
+		x = fmt.Sprintf("'%d+%d-mod(t*%d\\,%d+text_w)'", layer.X, layer.Width, speed, layer.Width)
+	}
+
+	var filters []string
+	if layer.BoxColor != "" {
+		filters = append(filters, fmt.Sprintf("drawbox=x=%d:y=%d:w=%d:h=%d:color=%s:t=fill", layer.X, layer.Y, layer.Width, layer.Height, layer.BoxColor))
+	}
+
+	filters = append(filters, fmt.Sprintf(
+		"drawtext=textfile='%s':reload=1:expansion=none%s:fontsize=%d:fontcolor=%s:line_spacing=8:x=%s:y=%d",
+		layer.Path, font, fontSize, fontColor, x, layer.Y+10,
+	))
+
+	return strings.Join(filters, ",")
+}
+
+// ensureTextFile drawtext fails to start when the text file does not exist
+func ensureTextFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	return os.WriteFile(path, []byte(" "), 0644)
+}
+
+// ensureOverlayFile with a transparent image until the application shows one
+func ensureOverlayFile(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewNRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b.Bytes(), 0644)
+}
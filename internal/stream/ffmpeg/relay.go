@@ -0,0 +1,153 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/stream"
+)
+
+const (
+	// relayBasePort is the first local udp port the encoder feeds the relays with, one port per destination
+	relayBasePort = 23000
+	// relayStableAfter is how long a relay has to stay up for its failed attempts to be forgotten
+	relayStableAfter = time.Minute
+	// relayInputTimeout makes the relay fail when the encoder stops feeding it, in microseconds
+	relayInputTimeout = 5000000
+)
+
+// relay publishes the local encoded feed to one destination, so every destination reconnects on its own
+// without restarting the encoder and the others
+type relay struct {
+	destination stream.Destination
+	format      string
+	port        int
+
+	mu        sync.Mutex
+	connected bool
+	attempts  int
+	lastError string
+}
+
+func newRelay(destination stream.Destination, index int) (*relay, error) {
+	format, err := destination.Format()
+	if err != nil {
+		return nil, err
+	}
+
+	return &relay{
+		destination: destination,
+		format:      format,
+		port:        relayBasePort + index,
+	}, nil
+}
+
+// feed is the encoder tee output for this relay
+func (r *relay) feed() string {
+	return "[f=mpegts:onfail=ignore]udp://127.0.0.1:" + strconv.Itoa(r.port) + "?pkt_size=1316"
+}
+
+func (r *relay) run(ctx context.Context, emit func(stream.Event)) {
+	policy := r.destination.Policy()
+
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := r.publish(ctx, emit)
+		if ctx.Err() != nil {
+			return
+		}
+
+		r.mu.Lock()
+		if time.Since(started) > relayStableAfter {
+			r.attempts = 0
+		}
+		r.attempts++
+		r.connected = false
+		if err != nil {
+			r.lastError = err.Error()
+		}
+		attempts := r.attempts
+		r.mu.Unlock()
+
+		log.Warnf("Destination %s down (attempt %d): %v", r.destination.Name, attempts, err)
+		emit(stream.Event{Type: stream.EventDestinationDown, Item: r.destination.Name, Err: err})
+
+		if policy.MaxAttempts > 0 && attempts == policy.MaxAttempts {
+			log.Errorf("Destination %s failed %d times in a row", r.destination.Name, attempts)
+			emit(stream.Event{Type: stream.EventDestinationAlert, Item: r.destination.Name, Err: err})
+		}
+
+		timer := time.NewTimer(policy.Delay(attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// publish copies the local feed to the destination, it blocks until ffmpeg exits
+func (r *relay) publish(ctx context.Context, emit func(stream.Event)) error {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "info",
+		"-i", "udp://127.0.0.1:" + strconv.Itoa(r.port) + "?fifo_size=1000000&overrun_nonfatal=1&timeout=" + strconv.Itoa(relayInputTimeout),
+		"-map", "0",
+		"-c", "copy",
+	}
+
+	if r.format == "flv" {
+		args = append(args, "-bsf:a", "aac_adtstoasc")
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", append(args, "-f", r.format, r.destination.URL)...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var lastLine string
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		// never log the url, it usually contains the stream key
+		line := strings.ReplaceAll(scanner.Text(), r.destination.URL, r.destination.Name)
+		lastLine = line
+
+		if strings.HasPrefix(line, "Output #0") {
+			r.mu.Lock()
+			r.connected = true
+			r.mu.Unlock()
+
+			log.Infof("Destination %s up", r.destination.Name)
+			emit(stream.Event{Type: stream.EventDestinationUp, Item: r.destination.Name})
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%w: %s", err, lastLine)
+	}
+
+	return fmt.Errorf("relay exited: %s", lastLine)
+}
+
+func (r *relay) status() stream.DestinationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return stream.DestinationStatus{
+		Connected: r.connected,
+		Attempts:  r.attempts,
+		LastError: r.lastError,
+	}
+}
@@ -0,0 +1,164 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/llumus/lulis/internal/media"
+	"github.com/llumus/lulis/internal/stream"
+)
+
+const (
+	// sequenceSlots is the number of rotating sets of sequence files, so a new sequence never rewrites the
+	// files of the previous one while the encoder may still read them
+	sequenceSlots = 2
+	// sequenceWait is how much of the idle loop is played, again and again, while the next video of a sequence
+	// is not ready yet, in seconds
+	sequenceWait = 0.5
+)
+
+// PlaySequence chains the videos with a concat file per video pointing to the file of the next one, the file of
+// the next video waits with a short cut of the idle loop pointing to itself until the video is ready, so the
+// videos play back to back without going through the playlist and the whole idle loop
+func (s *Stream) PlaySequence(ctx context.Context, paths <-chan string) error {
+	var first string
+	select {
+	case path, ok := <-paths:
+		if !ok {
+			return nil
+		}
+		first = path
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	s.sequence = (s.sequence + 1) % sequenceSlots
+	prefix := "sequence_" + strconv.Itoa(s.sequence) + "_"
+	idle := s.idleLoop
+	s.isPlaying = true
+	s.currentItem = first
+	s.mu.Unlock()
+
+	dir := filepath.Dir(s.playlistPath)
+	if old, err := filepath.Glob(filepath.Join(dir, prefix+"*.txt")); err == nil {
+		for _, file := range old {
+			_ = os.Remove(file)
+		}
+	}
+
+	var (
+		index = 0
+		end   time.Time
+	)
+
+	// writeVideo points the waiting file of the index to the video, the next index waits
+	writeVideo := func(path string) error {
+		next := prefix + strconv.Itoa(index+1) + ".txt"
+		if err := writeConcat(filepath.Join(dir, next), "file '"+idle+"'", "outpoint "+strconv.FormatFloat(sequenceWait, 'f', 1, 64), "file '"+next+"'"); err != nil {
+			return err
+		}
+
+		if err := writeConcat(filepath.Join(dir, prefix+strconv.Itoa(index)+".txt"), "file '"+filepath.Base(path)+"'", "file '"+next+"'"); err != nil {
+			return err
+		}
+
+		duration, err := media.Duration(path)
+		if err != nil {
+			log.Errorf("Error getting video duration: %s", err)
+			duration = 10
+		}
+
+		// a video ready after the previous one finished starts with the next pass of the waiting file
+		start := time.Now()
+		if end.After(start) {
+			start = end
+		} else if index > 0 {
+			start = start.Add(time.Duration(sequenceWait * float64(time.Second)))
+		}
+		end = start.Add(time.Duration(duration * float64(time.Second)))
+
+		index++
+		s.emit(stream.Event{Type: stream.EventItemStarted, Item: path})
+		return nil
+	}
+
+	err := writeVideo(first)
+	if err == nil {
+		s.mu.Lock()
+		err = s.replaceSecondLine(s.tempPlaylistPath, "file '"+prefix+"0.txt'")
+		s.mu.Unlock()
+	}
+
+	if err != nil {
+		_ = s.finishItem()
+		return err
+	}
+
+	log.Infof("Sequence %s started with %s", prefix, first)
+
+loop:
+	for {
+		select {
+		case path, ok := <-paths:
+			if !ok {
+				break loop
+			}
+
+			s.mu.Lock()
+			s.currentItem = path
+			s.mu.Unlock()
+
+			if err := writeVideo(path); err != nil {
+				log.Errorf("Error adding %s to sequence %s: %s", path, prefix, err)
+			}
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	// the last waiting file plays the idle loop once and goes back to the playlist
+	if err := writeConcat(filepath.Join(dir, prefix+strconv.Itoa(index)+".txt"), "file '"+idle+"'"); err != nil {
+		log.Errorf("Error ending sequence %s: %s", prefix, err)
+	}
+
+	if ctx.Err() == nil {
+		wait := time.Until(end) + 2*time.Second
+		log.Infof("Sequence %s complete with %d videos, waiting for %s", prefix, index, wait.Round(time.Second))
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			log.Infof("Sequence %s cancelled, putting loop back", prefix)
+		}
+	}
+
+	if err := s.finishItem(); err != nil {
+		return err
+	}
+
+	s.emit(stream.Event{Type: stream.EventItemFinished, Item: first, Err: ctx.Err()})
+	return ctx.Err()
+}
+
+// writeConcat writes a concat file atomically, the encoder may open it at any time
+func writeConcat(path string, lines ...string) error {
+	content := "ffconcat version 1.0\n"
+	for _, line := range lines {
+		content += line + "\n"
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,187 @@
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Layer types
+const (
+	// LayerFace is the playlist video, the lip sync answers and the idle loops
+	LayerFace = "face"
+	// LayerImage is a still image, reloaded when the file changes, used for backgrounds, logos and overlays
+	LayerImage = "image"
+	// LayerText is a box with the content of a text file, reloaded every frame
+	LayerText = "text"
+	// LayerTicker is a text file scrolling from right to left
+	LayerTicker = "ticker"
+)
+
+// Layer sources written by the application, other layers are managed externally
+const (
+	SourceChat      = "chat"
+	SourceQuestions = "questions"
+	// SourceOverlay is an image layer showing the images the personas pick
+	SourceOverlay = "overlay"
+)
+
+// Layout is the declarative composition of the stream output, layers are drawn in order
+type Layout struct {
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Background string  `json:"background"`
+	Font       string  `json:"font,omitempty"`
+	Layers     []Layer `json:"layers"`
+}
+
+type Layer struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Path   string `json:"path,omitempty"`
+	Source string `json:"source,omitempty"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// text and ticker options
+	FontSize  int    `json:"font_size,omitempty"`
+	FontColor string `json:"font_color,omitempty"`
+	BoxColor  string `json:"box_color,omitempty"`
+	MaxLines  int    `json:"max_lines,omitempty"`
+	// Speed of the ticker in pixels per second
+	Speed int `json:"speed,omitempty"`
+}
+
+// Load reads the layout, relative layer paths are resolved from the layout folder
+func Load(path string) (*Layout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var layout Layout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, fmt.Errorf("error parsing layout %s: %w", path, err)
+	}
+
+	if layout.Width <= 0 || layout.Height <= 0 {
+		layout.Width, layout.Height = 1280, 720
+	}
+
+	if layout.Background == "" {
+		layout.Background = "black"
+	}
+
+	var faces int
+	for i := range layout.Layers {
+		layer := &layout.Layers[i]
+		if layer.Name == "" {
+			layer.Name = fmt.Sprintf("%s-%d", layer.Type, i+1)
+		}
+
+		switch layer.Type {
+		case LayerFace:
+			faces++
+		case LayerImage, LayerText, LayerTicker:
+			if layer.Path == "" {
+				return nil, fmt.Errorf("layer %s has no path", layer.Name)
+			}
+		default:
+			return nil, fmt.Errorf("layer %s has an unknown type %q", layer.Name, layer.Type)
+		}
+
+		if layer.Path != "" && !filepath.IsAbs(layer.Path) {
+			layer.Path = filepath.Join(filepath.Dir(path), layer.Path)
+		}
+
+		if layer.Width <= 0 || layer.Height <= 0 {
+			layer.Width, layer.Height = layout.Width, layout.Height
+		}
+	}
+
+	if faces != 1 {
+		return nil, fmt.Errorf("layout %s must have exactly one face layer, found %d", path, faces)
+	}
+
+	return &layout, nil
+}
+
+// Sources lists the layers fed by the given source
+func (l *Layout) Sources(source string) []Layer {
+	var layers []Layer
+	for _, layer := range l.Layers {
+		if layer.Type != LayerFace && layer.Source == source {
+			layers = append(layers, layer)
+		}
+	}
+
+	return layers
+}
+
+// TextFile keeps the latest lines of a text layer, the file is replaced atomically
+// so ffmpeg never reloads a half written file
+type TextFile struct {
+	mu        sync.Mutex
+	path      string
+	maxLines  int
+	separator string
+	lines     []string
+}
+
+// NewTextFile for the layer, tickers get their lines on a single line
+func NewTextFile(layer Layer) *TextFile {
+	t := &TextFile{
+		path:      layer.Path,
+		maxLines:  layer.MaxLines,
+		separator: "\n",
+	}
+
+	if t.maxLines <= 0 {
+		t.maxLines = 5
+	}
+
+	if layer.Type == LayerTicker {
+		t.separator = "   •   "
+	}
+
+	return t
+}
+
+// Append adds a line, dropping the oldest lines over the limit
+func (t *TextFile) Append(line string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lines = append(t.lines, strings.ReplaceAll(line, "\n", " "))
+	if len(t.lines) > t.maxLines {
+		t.lines = t.lines[len(t.lines)-t.maxLines:]
+	}
+
+	return t.write(strings.Join(t.lines, t.separator))
+}
+
+// Set replaces all the lines
+func (t *TextFile) Set(lines []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lines = lines
+	if len(t.lines) > t.maxLines {
+		t.lines = t.lines[len(t.lines)-t.maxLines:]
+	}
+
+	return t.write(strings.Join(t.lines, t.separator))
+}
+
+func (t *TextFile) write(content string) error {
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, t.path)
+}
@@ -1,7 +1,72 @@
 package stream
 
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventStarted      EventType = "started"
+	EventStopped      EventType = "stopped"
+	EventCrashed      EventType = "crashed"
+	EventItemStarted  EventType = "item-started"
+	EventItemFinished EventType = "item-finished"
+	// destination events have the destination name in Item
+	EventDestinationUp    EventType = "destination-up"
+	EventDestinationDown  EventType = "destination-down"
+	EventDestinationAlert EventType = "destination-alert"
+)
+
+// Event is emitted on the stream lifecycle changes and for every played item
+type Event struct {
+	Type EventType `json:"type"`
+	Item string    `json:"item,omitempty"`
+	Err  error     `json:"-"`
+	Time time.Time `json:"time"`
+}
+
+// Status is a snapshot of the stream state
+type Status struct {
+	Running   bool      `json:"running"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	// Uptime is written in seconds in the json
+	Uptime      time.Duration `json:"-"`
+	CurrentItem string        `json:"current_item,omitempty"`
+	IdleLoop    string        `json:"idle_loop"`
+	LastError   string        `json:"last_error,omitempty"`
+	Restarts    int           `json:"restarts"`
+	// Destinations keyed by name
+	Destinations map[string]DestinationStatus `json:"destinations"`
+}
+
+// MarshalJSON writes the uptime in seconds, a time.Duration would be nanoseconds
+func (s Status) MarshalJSON() ([]byte, error) {
+	type status Status
+	return json.Marshal(struct {
+		status
+		Uptime float64 `json:"uptime"`
+	}{status(s), s.Uptime.Seconds()})
+}
+
+type DestinationStatus struct {
+	Connected bool   `json:"connected"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
 type Stream interface {
-	StartStream() error
+	// StartStream blocks until the stream stops, crashes or the context is cancelled
+	StartStream(ctx context.Context) error
 	StopStream() error
-	PlayLatest(path string) error
+	// PlayLatest blocks until the video finished playing or the context is cancelled
+	PlayLatest(ctx context.Context, path string) error
+	// PlaySequence plays the videos back to back as they come until the channel is closed, blocks until the
+	// last one finished playing or the context is cancelled
+	PlaySequence(ctx context.Context, paths <-chan string) error
+	SetIdleLoop(path string) error
+	Status() Status
+	Events() <-chan Event
 }
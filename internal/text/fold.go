@@ -0,0 +1,35 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// diacritics folded to their base letter, the x/text package isn't worth a dependency for the latin alphabets
+var diacritics = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a',
+	'ç': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i',
+	'ñ': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ý': 'y', 'ÿ': 'y',
+}
+
+// Fold the text to lower case without diacritics, "Você" is "voce"
+func Fold(s string) string {
+	return strings.Map(func(r rune) rune {
+		if base, ok := diacritics[r]; ok {
+			return base
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+// Words of the text folded, without the punctuation
+func Words(s string) []string {
+	return strings.FieldsFunc(Fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,118 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/llumus/lulis/internal/fs"
+	"github.com/llumus/lulis/internal/media"
+	"github.com/llumus/lulis/internal/thumbnail"
+)
+
+const (
+	thumbnailWidth  = 640
+	previewWidth    = 320
+	previewDuration = 3.0
+	previewFps      = 10
+	keyPrefix       = "thumbnails/"
+)
+
+// Generator extracts a representative frame and an animated preview (webp or gif) from a video,
+// the images are written next to the video and saved to the file system
+type Generator struct {
+	previewFormat string
+	fs            fs.FileSystem
+}
+
+func NewGenerator(previewFormat string, fs fs.FileSystem) *Generator {
+	if previewFormat != "gif" {
+		previewFormat = "webp"
+	}
+
+	return &Generator{
+		previewFormat: previewFormat,
+		fs:            fs,
+	}
+}
+
+func (g *Generator) Generate(ctx context.Context, videoPath string) (thumbnail.Images, error) {
+	var (
+		id            = uuid.NewString()
+		basePath      = strings.TrimSuffix(videoPath, filepath.Ext(videoPath))
+		thumbnailPath = basePath + ".jpg"
+		previewPath   = basePath + "." + g.previewFormat
+	)
+
+	duration, err := media.Duration(videoPath)
+	if err != nil {
+		return thumbnail.Images{}, err
+	}
+
+	// the thumbnail filter picks the most representative frame of each batch of frames
+	err = run(ctx, "-y",
+		"-i", videoPath,
+		"-vf", "thumbnail=100,scale="+strconv.Itoa(thumbnailWidth)+":-2",
+		"-frames:v", "1",
+		"-q:v", "3",
+		thumbnailPath,
+	)
+	if err != nil {
+		return thumbnail.Images{}, err
+	}
+
+	start := duration/2 - previewDuration/2
+	if start < 0 {
+		start = 0
+	}
+
+	err = run(ctx, append([]string{"-y",
+		"-ss", strconv.FormatFloat(start, 'f', 2, 64),
+		"-t", strconv.FormatFloat(previewDuration, 'f', 2, 64),
+		"-i", videoPath,
+		"-an",
+		"-loop", "0",
+	}, g.previewArgs(previewPath)...)...)
+	if err != nil {
+		return thumbnail.Images{}, err
+	}
+
+	thumbnailKey, err := g.fs.Save(keyPrefix+id+".jpg", thumbnailPath, "image/jpeg")
+	if err != nil {
+		return thumbnail.Images{}, err
+	}
+
+	previewKey, err := g.fs.Save(keyPrefix+id+"."+g.previewFormat, previewPath, "image/"+g.previewFormat)
+	if err != nil {
+		return thumbnail.Images{}, err
+	}
+
+	return thumbnail.Images{
+		Thumbnail: thumbnailKey,
+		Preview:   previewKey,
+	}, nil
+}
+
+func (g *Generator) previewArgs(previewPath string) []string {
+	scale := "fps=" + strconv.Itoa(previewFps) + ",scale=" + strconv.Itoa(previewWidth) + ":-2:flags=lanczos"
+
+	if g.previewFormat == "gif" {
+		return []string{"-vf", scale + ",split[a][b];[a]palettegen[p];[b][p]paletteuse", previewPath}
+	}
+
+	return []string{"-vf", scale, "-c:v", "libwebp", "-q:v", "60", previewPath}
+}
+
+func run(ctx context.Context, args ...string) error {
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg error: %w: %s", err, lines[len(lines)-1])
+	}
+
+	return nil
+}
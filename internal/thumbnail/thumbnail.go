@@ -0,0 +1,13 @@
+package thumbnail
+
+import "context"
+
+// Images keys of the generated images in the file system
+type Images struct {
+	Thumbnail string `json:"thumbnail"`
+	Preview   string `json:"preview"`
+}
+
+type Generator interface {
+	Generate(ctx context.Context, videoPath string) (Images, error)
+}
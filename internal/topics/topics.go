@@ -0,0 +1,301 @@
+package topics
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/llumus/lulis/internal/text"
+)
+
+// maxEntries is the number of chat messages and of questions remembered
+const maxEntries = 50
+
+// chatMessages is the number of the latest chat messages given to the question generation
+const chatMessages = 15
+
+// chatWindow is how old a chat message can be to still be part of the conversation
+const chatWindow = 15 * time.Minute
+
+// recentQuestions is the number of the latest questions the generation must not repeat
+const recentQuestions = 10
+
+// trendingWords is the number of trending words given to the question generation, a word trends when it is in
+// at least minTrending questions
+const (
+	trendingWords = 5
+	minTrending   = 2
+)
+
+// stopWords are the common portuguese and english words that are not topics, words shorter than 4 letters are
+// never topics
+var stopWords = map[string]bool{
+	"voce": true, "qual": true, "quais": true, "sobre": true, "para": true, "como": true, "porque": true,
+	"quando": true, "onde": true, "isso": true, "esse": true, "essa": true, "este": true, "esta": true,
+	"acha": true, "fala": true, "pode": true, "seria": true, "muito": true, "mais": true, "pelo": true,
+	"pela": true, "numa": true, "what": true, "that": true, "this": true, "with": true, "about": true,
+	"your": true, "have": true, "from": true, "would": true, "think": true, "there": true, "they": true,
+}
+
+type entry struct {
+	text string
+	at   time.Time
+}
+
+// Brief is what the chat is talking about, to generate questions that follow the stream
+type Brief struct {
+	// Topic picked in the pool of the persona, empty when the persona has no topics
+	Topic string
+	// Chat are the latest chat messages as "user: message"
+	Chat []string
+	// Trending words across the latest questions, the most asked first
+	Trending []string
+	// Recent questions, not to be asked again
+	Recent []string
+}
+
+type contextKey struct{}
+
+// NewContext carries the brief to the question generation
+func NewContext(ctx context.Context, b Brief) context.Context {
+	return context.WithValue(ctx, contextKey{}, b)
+}
+
+func FromContext(ctx context.Context) (Brief, bool) {
+	b, ok := ctx.Value(contextKey{}).(Brief)
+	return b, ok
+}
+
+// Pool follows the chat messages and the questions, and picks the topics of the automatic questions by their
+// weight, a topic covered within the recency window is not picked again
+type Pool struct {
+	mu        sync.Mutex
+	messages  []entry
+	questions []entry
+	// covered is when each folded topic was last picked
+	covered map[string]time.Time
+	current string
+	window  time.Duration
+}
+
+func NewPool(window time.Duration) *Pool {
+	return &Pool{
+		covered: make(map[string]time.Time),
+		window:  window,
+	}
+}
+
+// AddMessage of the chat, only messages that passed the moderation should be added
+func (p *Pool) AddMessage(user, message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = remember(p.messages, entry{text: user + ": " + message, at: time.Now()})
+}
+
+// AddQuestion asked by a viewer or generated, its topic counts as covered
+func (p *Pool) AddQuestion(question string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.questions = remember(p.questions, entry{text: question, at: time.Now()})
+}
+
+func remember(entries []entry, e entry) []entry {
+	entries = append(entries, e)
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+
+	return entries
+}
+
+// Brief for a new question on one of the topics, ignore are words never trending, e.g. the persona trigger
+func (p *Pool) Brief(topics []string, weights map[string]float64, ignore string) Brief {
+	b := Brief{Topic: p.Pick(topics, weights)}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, message := range latest(p.messages, chatMessages) {
+		if time.Since(message.at) <= chatWindow {
+			b.Chat = append(b.Chat, message.text)
+		}
+	}
+
+	for _, question := range latest(p.questions, recentQuestions) {
+		b.Recent = append(b.Recent, question.text)
+	}
+
+	b.Trending = p.trending(ignore)
+	return b
+}
+
+func latest(entries []entry, n int) []entry {
+	if len(entries) > n {
+		return entries[len(entries)-n:]
+	}
+
+	return entries
+}
+
+// trending words of the questions within the recency window, must be called with the lock held
+func (p *Pool) trending(ignore string) []string {
+	ignored := make(map[string]bool)
+	for _, word := range text.Words(ignore) {
+		ignored[word] = true
+	}
+
+	counts := make(map[string]int)
+	for _, question := range p.questions {
+		if time.Since(question.at) > p.window {
+			continue
+		}
+
+		// a word counts once per question
+		seen := make(map[string]bool)
+		for _, word := range text.Words(question.text) {
+			if len([]rune(word)) < 4 || stopWords[word] || ignored[word] || seen[word] {
+				continue
+			}
+			seen[word] = true
+			counts[word]++
+		}
+	}
+
+	var words []string
+	for word, count := range counts {
+		if count >= minTrending {
+			words = append(words, word)
+		}
+	}
+
+	sort.Slice(words, func(a, b int) bool {
+		if counts[words[a]] != counts[words[b]] {
+			return counts[words[a]] > counts[words[b]]
+		}
+		return words[a] < words[b]
+	})
+
+	if len(words) > trendingWords {
+		words = words[:trendingWords]
+	}
+
+	return words
+}
+
+// Pick a topic by its weight, 1 when it has none, and marks it as covered. Topics covered within the recency
+// window, picked or asked about, are skipped, the older ones weigh less the more recently they were covered.
+// When every topic was covered, the least recently covered one is picked, topics weighing 0 never are
+func (p *Pool) Pick(topics []string, weights map[string]float64) string {
+	if len(topics) == 0 {
+		return ""
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		total    float64
+		scores   = make([]float64, len(topics))
+		oldest   = -1
+		oldestAt time.Time
+	)
+
+	for i, topic := range topics {
+		weight, ok := weights[topic]
+		if !ok {
+			weight = 1
+		}
+
+		if weight <= 0 {
+			continue
+		}
+
+		at := p.coveredAt(topic)
+		if oldest < 0 || at.Before(oldestAt) {
+			oldest, oldestAt = i, at
+		}
+
+		age := time.Since(at)
+		if age < p.window {
+			continue
+		}
+
+		// the penalty fades out over a second window
+		if penalty := float64(age) / float64(2*p.window); penalty < 1 {
+			weight *= penalty
+		}
+
+		scores[i] = weight
+		total += weight
+	}
+
+	if oldest < 0 {
+		return ""
+	}
+
+	picked := oldest
+	if total > 0 {
+		r := rand.Float64() * total
+		for i, score := range scores {
+			if score == 0 {
+				continue
+			}
+
+			picked = i
+			if r < score {
+				break
+			}
+			r -= score
+		}
+	}
+
+	p.covered[text.Fold(topics[picked])] = time.Now()
+	p.current = topics[picked]
+	return topics[picked]
+}
+
+// Current is the latest topic picked, what the stream is talking about
+func (p *Pool) Current() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.current
+}
+
+// coveredAt is the last time the topic was picked or was in a question, must be called with the lock held
+func (p *Pool) coveredAt(topic string) time.Time {
+	at := p.covered[text.Fold(topic)]
+
+	words := text.Words(topic)
+	if len(words) == 0 {
+		return at
+	}
+
+	for _, question := range p.questions {
+		if question.at.After(at) && mentions(question.text, words) {
+			at = question.at
+		}
+	}
+
+	return at
+}
+
+// mentions when every word of the topic is in the text
+func mentions(s string, words []string) bool {
+	in := make(map[string]bool)
+	for _, word := range text.Words(s) {
+		in[word] = true
+	}
+
+	for _, word := range words {
+		if !in[word] {
+			return false
+		}
+	}
+
+	return true
+}
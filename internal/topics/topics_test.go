@@ -0,0 +1,108 @@
+package topics
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const window = 12 * time.Hour
+
+func TestPick(t *testing.T) {
+	tests := []struct {
+		name    string
+		topics  []string
+		weights map[string]float64
+		covered map[string]time.Duration
+		asked   []string
+		want    string
+	}{
+		{"no topics", nil, nil, nil, nil, ""},
+		{"recently picked", []string{"futebol", "economia"}, nil, map[string]time.Duration{"futebol": time.Hour}, nil, "economia"},
+		{"recently asked about", []string{"Copa do Mundo", "economia"}, nil, nil, []string{"Who wins the copa do mundo?"}, "economia"},
+		{"never weighing 0", []string{"futebol", "economia"}, map[string]float64{"futebol": 0}, nil, nil, "economia"},
+		{"every topic covered", []string{"futebol", "economia"}, nil, map[string]time.Duration{"futebol": time.Hour, "economia": 2 * time.Hour}, nil, "economia"},
+		{"only topics weighing 0", []string{"futebol"}, map[string]float64{"futebol": 0}, nil, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(window)
+			for topic, ago := range tt.covered {
+				p.covered[topic] = time.Now().Add(-ago)
+			}
+			for _, question := range tt.asked {
+				p.AddQuestion(question)
+			}
+
+			if got := p.Pick(tt.topics, tt.weights); got != tt.want {
+				t.Errorf("Pick() = %q, want %q", got, tt.want)
+			}
+			if got := p.Current(); got != tt.want {
+				t.Errorf("Current() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickRecencyPenalty(t *testing.T) {
+	tests := []struct {
+		name string
+		ago  time.Duration
+		// share of the picks of the covered topic against a topic never covered, both weighing 1
+		share float64
+	}{
+		{"within the window", window / 2, 0},
+		{"half penalty", window, 1.0 / 3},
+		{"penalty faded out", 2 * window, 0.5},
+	}
+
+	const picks = 4000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int
+			for n := 0; n < picks; n++ {
+				p := NewPool(window)
+				p.covered["futebol"] = time.Now().Add(-tt.ago)
+				if p.Pick([]string{"futebol", "economia"}, nil) == "futebol" {
+					count++
+				}
+			}
+
+			if share := float64(count) / picks; math.Abs(share-tt.share) > 0.05 {
+				t.Errorf("futebol picked %.2f of the times, want %.2f", share, tt.share)
+			}
+		})
+	}
+}
+
+func TestBrief(t *testing.T) {
+	p := NewPool(window)
+	p.messages = append(p.messages, entry{text: "old: hello", at: time.Now().Add(-time.Hour)})
+	p.AddMessage("ana", "que jogo!")
+	for _, question := range []string{
+		"Lula, quem ganha a copa?",
+		"Lula, o Brasil ganha a copa?",
+		"Lula, voce gosta do Brasil?",
+		"Lula, qual sua comida favorita?",
+	} {
+		p.AddQuestion(question)
+	}
+	p.questions = append([]entry{{text: "Lula, e a inflacao? E a inflacao?", at: time.Now().Add(-2 * window)}}, p.questions...)
+
+	b := p.Brief([]string{"futebol"}, nil, "Lula,")
+
+	if b.Topic != "futebol" {
+		t.Errorf("Topic = %q, want futebol", b.Topic)
+	}
+	if strings.Join(b.Chat, "|") != "ana: que jogo!" {
+		t.Errorf("Chat = %q, want the messages of the chat window", b.Chat)
+	}
+	if strings.Join(b.Trending, ",") != "brasil,copa,ganha" {
+		t.Errorf("Trending = %q, want brasil,copa,ganha", b.Trending)
+	}
+	if len(b.Recent) != 5 {
+		t.Errorf("Recent = %q, want the 5 questions", b.Recent)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/llumus/lulis/internal/cost"
 	"github.com/llumus/lulis/internal/fs"
+	"github.com/llumus/lulis/internal/persona"
 )
 
 const baseUrl = "https://api.elevenlabs.io/v1/text-to-speech/"
@@ -43,8 +46,14 @@ func NewElevenLabs(apiKey string, basePath string, voiceId string, client *http.
 	}
 }
 
-func (e *ElevenLabs) GenerateAudio(_ context.Context, text string) (string, error) {
+func (e *ElevenLabs) GenerateAudio(ctx context.Context, text string) (string, error) {
 	var newFileName = uuid.NewString() + ".mp3"
+
+	voiceId := e.voiceId
+	if p, ok := persona.FromContext(ctx); ok && p.VoiceID != "" {
+		voiceId = p.VoiceID
+	}
+
 	payload := Payload{
 		Text:    text,
 		ModelID: "eleven_multilingual_v2",
@@ -60,7 +69,7 @@ func (e *ElevenLabs) GenerateAudio(_ context.Context, text string) (string, erro
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", baseUrl+e.voiceId, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", baseUrl+voiceId, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", err
 	}
@@ -80,5 +89,9 @@ func (e *ElevenLabs) GenerateAudio(_ context.Context, text string) (string, erro
 		return "", err
 	}
 
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		cost.Record(ctx, "elevenlabs", payload.ModelID, cost.UnitCharacters, float64(utf8.RuneCountInString(text)))
+	}
+
 	return e.fs.SaveFile(newFileName, bytes.NewReader(body), "audio/mpeg", int64(len(body)))
 }